@@ -2,7 +2,10 @@ module fm
 
 go 1.24.1
 
-require github.com/aws/aws-sdk-go v1.55.7
+require (
+	github.com/aws/aws-sdk-go v1.55.7
+	github.com/google/uuid v1.6.0
+)
 
 require (
 	github.com/andybalholm/brotli v1.1.1 // indirect
@@ -13,7 +16,6 @@ require (
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/gofiber/schema v1.2.0 // indirect
 	github.com/gofiber/utils/v2 v2.0.0-beta.7 // indirect
-	github.com/google/uuid v1.6.0 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
@@ -45,7 +47,7 @@ require (
 	github.com/golang-migrate/migrate/v4 v4.18.3
 	github.com/jmespath/go-jmespath v0.4.0 // indirect
 	github.com/lib/pq v1.10.9
-	github.com/syntaxLabz/configManager v1.1.0 // indirect
+	github.com/syntaxLabz/configManager v1.1.0
 	github.com/syntaxLabz/errors v1.0.2
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	gorm.io/gorm v1.30.0
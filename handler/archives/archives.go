@@ -0,0 +1,65 @@
+package archives
+
+import (
+	"fm/models"
+	"fm/service"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+type handler struct {
+	svc service.Archive
+}
+
+func New(s service.Archive) *handler {
+	return &handler{svc: s}
+}
+
+// Create starts zipping a folder in the background and answers right away
+// with the job to poll.
+func (h *handler) Create(ctx fiber.Ctx) error {
+	folderId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid folder ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	jobResp, serviceError := h.svc.Create(ctx, &folderId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusAccepted).JSON(models.Response{
+		Message: "Archive job started successfully",
+		Data:    jobResp,
+	})
+	return nil
+}
+
+func (h *handler) GetById(ctx fiber.Ctx) error {
+	id, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid job ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	jobResp, serviceError := h.svc.GetById(ctx, id)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Job retrieved successfully",
+		Data:    jobResp,
+	})
+	return nil
+}
@@ -0,0 +1,159 @@
+package files
+
+import (
+	"fm/models"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// Content streams the file's object through the service. It answers
+// conditional requests from the files row alone and serves a single byte
+// range when asked, so clients can seek in large media files.
+func (h *handler) Content(ctx fiber.Ctx) error {
+	fileId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	file, serviceError := h.svc.GetById(ctx, &fileId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	etag := fileETag(file)
+	lastModified := file.UpdatedAt.UTC().Truncate(time.Second)
+
+	ctx.Set(fiber.HeaderETag, etag)
+	ctx.Set(fiber.HeaderLastModified, lastModified.Format(http.TimeFormat))
+	ctx.Set(fiber.HeaderAcceptRanges, "bytes")
+
+	if notModified(ctx, etag, lastModified) {
+		return ctx.SendStatus(fiber.StatusNotModified)
+	}
+
+	size := int64(file.Size)
+	offset, length := int64(0), size
+	status := fiber.StatusOK
+
+	rangeHeader := ctx.Get(fiber.HeaderRange)
+	ifRange := ctx.Get(fiber.HeaderIfRange)
+	if rangeHeader != "" && (ifRange == "" || ifRange == etag) {
+		start, end, ok := parseRange(rangeHeader, size)
+		if !ok {
+			ctx.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			statusCode, errResp := httperrors.New(codes.RangeNotSatisfiable, "Requested range not satisfiable").ErrorResponse()
+			ctx.Status(statusCode).JSON(errResp)
+			return nil
+		}
+		if start >= 0 {
+			offset, length = start, end-start+1
+			status = fiber.StatusPartialContent
+			ctx.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		}
+	}
+
+	body, serviceError := h.svc.OpenContent(ctx, file, offset, length)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	contentType := file.MimeType
+	if contentType == "" {
+		contentType = fiber.MIMEOctetStream
+	}
+	ctx.Set(fiber.HeaderContentType, contentType)
+
+	// the body is closed once it has been written out
+	return ctx.Status(status).SendStream(body, int(length))
+}
+
+func fileETag(file *models.File) string {
+	if file.Checksum != "" {
+		return `"` + file.Checksum + `"`
+	}
+	return fmt.Sprintf(`"%s-%x"`, file.Id, file.UpdatedAt.UnixNano())
+}
+
+// notModified evaluates If-None-Match and, when that is absent, If-Modified-Since.
+func notModified(ctx fiber.Ctx, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := ctx.Get(fiber.HeaderIfNoneMatch); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if ifModifiedSince := ctx.Get(fiber.HeaderIfModifiedSince); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		return err == nil && !lastModified.After(since)
+	}
+	return false
+}
+
+// parseRange reads a single "bytes=" range against an object of size bytes and
+// returns the inclusive bounds. Malformed and multiple ranges are ignored and
+// yield start -1, meaning the whole object is served. ok is false when the
+// range can't be satisfied.
+func parseRange(header string, size int64) (start, end int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return -1, -1, true
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return -1, -1, true
+	}
+
+	if first == "" {
+		// suffix range: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return -1, -1, true
+		}
+		if n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return -1, -1, true
+	}
+	if start >= size {
+		return 0, 0, false
+	}
+
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return -1, -1, true
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, true
+}
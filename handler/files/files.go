@@ -1,11 +1,16 @@
 package files
 
 import (
+	"bytes"
+	"fm/handler/listing"
 	"fm/models"
 	"fm/service"
+	"io"
+	"net/url"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
 	"github.com/syntaxLabz/errors/pkg/httperrors"
 )
 
@@ -26,7 +31,7 @@ func (h *handler) Create(ctx fiber.Ctx) error {
 		ctx.Status(statuscode).JSON(errResp)
 		return nil
 	}
-	fileResp, serviceError := h.svc.Create(ctx, &file)
+	fileResp, serviceError := h.svc.Create(ctx, &file, ctx.Query("on_conflict"))
 
 	if serviceError != nil {
 		statusCode, errResp := serviceError.ErrorResponse()
@@ -75,7 +80,73 @@ func (h *handler) GetFiles(ctx fiber.Ctx) error {
 		return nil
 	}
 
-	fileResp, serviceError := h.svc.GetFiles(ctx, folderId)
+	includePending := ctx.Query("include_pending") == "true"
+
+	opts, optsError := listing.FileOptions(ctx)
+	if optsError != nil {
+		statusCode, errResp := optsError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	fileResp, page, serviceError := h.svc.GetFiles(ctx, folderId, includePending, opts)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message:    "Files retrieved successfully",
+		Data:       fileResp,
+		NextCursor: page.NextCursor,
+		Sort:       &page.Sort,
+	})
+	return nil
+}
+
+func (h *handler) Delete(ctx fiber.Ctx) error {
+	id := ctx.Params("id")
+	fileId, err := uuid.Parse(id)
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	fileResp, serviceError := h.svc.Delete(ctx, &fileId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "File moved to trash",
+		Data:    fileResp,
+	})
+	return nil
+}
+
+func (h *handler) Update(ctx fiber.Ctx) error {
+	id := ctx.Params("id")
+	fileId, err := uuid.Parse(id)
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	var patch models.FilePatch
+	err = ctx.Bind().JSON(&patch)
+	if err != nil || (patch.Name == nil && patch.FolderId == nil) {
+		validationError := httperrors.BodyValidationError()
+		statuscode, errResp := validationError.ErrorResponse()
+		ctx.Status(statuscode).JSON(errResp)
+		return nil
+	}
+
+	fileResp, serviceError := h.svc.Update(ctx, &fileId, &patch)
 	if serviceError != nil {
 		statusCode, errResp := serviceError.ErrorResponse()
 		ctx.Status(statusCode).JSON(errResp)
@@ -83,7 +154,99 @@ func (h *handler) GetFiles(ctx fiber.Ctx) error {
 	}
 
 	ctx.Status(fiber.StatusOK).JSON(models.Response{
-		Message: "Files retrieved successfully",
+		Message: "File updated successfully",
+		Data:    fileResp,
+	})
+	return nil
+}
+
+func (h *handler) Download(ctx fiber.Ctx) error {
+	id := ctx.Params("id")
+	fileId, err := uuid.Parse(id)
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	downloadResp, serviceError := h.svc.GetDownloadURL(ctx, &fileId, ctx.Query("disposition"))
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Download URL generated successfully",
+		Data:    downloadResp,
+	})
+	return nil
+}
+
+func (h *handler) Complete(ctx fiber.Ctx) error {
+	id := ctx.Params("id")
+	fileId, err := uuid.Parse(id)
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	fileResp, serviceError := h.svc.Complete(ctx, &fileId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "File upload completed successfully",
+		Data:    fileResp,
+	})
+	return nil
+}
+
+// Upload accepts the raw request body as the content of a new file, for
+// callers that can't use the presigned URL flow of Create.
+func (h *handler) Upload(ctx fiber.Ctx) error {
+	folderId, err := uuid.Parse(ctx.Params("folderId"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid folder ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	name, err := url.PathUnescape(ctx.Params("name"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file name").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	var uploadedBy uuid.UUID
+	if by := ctx.Query("uploaded_by"); by != "" {
+		uploadedBy, err = uuid.Parse(by)
+		if err != nil {
+			statusCode, errResp := httperrors.RequestValidationError(httperrors.InvalidQueryParam("uploaded_by")).ErrorResponse()
+			ctx.Status(statusCode).JSON(errResp)
+			return nil
+		}
+	}
+
+	var body io.Reader = ctx.Request().BodyStream()
+	if body == nil {
+		body = bytes.NewReader(ctx.Body())
+	}
+
+	fileResp, serviceError := h.svc.Upload(ctx, folderId, name, uploadedBy, body)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusCreated).JSON(models.Response{
+		Message: "File uploaded successfully",
 		Data:    fileResp,
 	})
 	return nil
@@ -0,0 +1,268 @@
+package files_test
+
+import (
+	"bytes"
+	"encoding/json"
+	handlerFiles "fm/handler/files"
+	handlerFolders "fm/handler/folders"
+	"fm/models"
+	svcFiles "fm/service/files"
+	svcFolders "fm/service/folders"
+	"fm/store/buckets"
+	"fm/store/buckets/fakestorage"
+	"fm/store/files"
+	"fm/store/folders"
+	"fm/store/storetest"
+	"fm/store/versions"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+)
+
+// newApp serves the file routes, and folder creation, from a migrated
+// database, keeping objects in a fake storage server behind the REST driver.
+func newApp(t *testing.T) (*fiber.App, *fakestorage.Server) {
+	t.Helper()
+
+	db := storetest.DB(t)
+	server := fakestorage.New("token")
+	t.Cleanup(server.Close)
+	bucket := buckets.New(server.URL, "views", "token")
+
+	fileStore := files.New(db)
+	folderStore := folders.New(db)
+	folderHandler := handlerFolders.New(svcFolders.New(folderStore, fileStore, bucket))
+	fileHandler := handlerFiles.New(svcFiles.New(fileStore, folderStore, versions.New(db), bucket, time.Minute))
+
+	app := fiber.New()
+	app.Post("/folder", folderHandler.Create)
+	app.Post("/file", fileHandler.Create)
+	app.Get("/file/:id", fileHandler.GetById)
+	app.Get("/file/:id/download", fileHandler.Download)
+	app.Get("/file/:id/content", fileHandler.Content)
+	app.Post("/file/:id/complete", fileHandler.Complete)
+	app.Delete("/file/:id", fileHandler.Delete)
+	app.Get("/file/:id/versions", fileHandler.GetVersions)
+	app.Put("/folder/:folderId/files/:name", fileHandler.Upload)
+	return app, server
+}
+
+// call sends a request with body, encoded as JSON unless it is a string, and
+// decodes the data of the response into out, when given. It returns the status.
+func call(t *testing.T, app *fiber.App, method, path string, body, out any) int {
+	t.Helper()
+
+	var payload bytes.Buffer
+	switch body := body.(type) {
+	case nil:
+	case string:
+		payload.WriteString(body)
+	default:
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	if _, raw := body.(string); !raw {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		response := models.Response{Data: out}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatalf("decoding the response to %s %s failed: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func createFolder(t *testing.T, app *fiber.App, name string) uuid.UUID {
+	t.Helper()
+
+	var folder models.Folder
+	if status := call(t, app, http.MethodPost, "/folder", models.Folder{Name: name, OwnerID: uuid.New()}, &folder); status != http.StatusCreated {
+		t.Fatalf("creating folder %q answered %d", name, status)
+	}
+	return folder.ID
+}
+
+func upload(t *testing.T, app *fiber.App, folderId uuid.UUID, name, content string) *models.File {
+	t.Helper()
+
+	var file models.File
+	path := "/folder/" + folderId.String() + "/files/" + name
+	if status := call(t, app, http.MethodPut, path, content, &file); status != http.StatusCreated {
+		t.Fatalf("uploading %q answered %d", name, status)
+	}
+	return &file
+}
+
+// content reads the file's content through the service.
+func content(t *testing.T, app *fiber.App, id uuid.UUID) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/file/"+id.String()+"/content", nil)
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("reading the content of %s answered %d", id, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUploadFile(t *testing.T) {
+	app, server := newApp(t)
+	folderId := createFolder(t, app, "Docs")
+
+	file := upload(t, app, folderId, "notes.txt", "hello")
+	if file.Status != models.FileStatusUploaded || file.Size != 5 {
+		t.Errorf("got status %q and size %d, want uploaded and 5", file.Status, file.Size)
+	}
+	if file.FullPath != "views/Docs/notes.txt" {
+		t.Errorf("got full path %q, want views/Docs/notes.txt", file.FullPath)
+	}
+	// content is kept under a key of its own, not under the file's path
+	if !strings.HasPrefix(file.S3Key, "views/.versions/"+file.Id.String()+"/") {
+		t.Errorf("got s3 key %q, want one below the file's versions", file.S3Key)
+	}
+	if got := content(t, app, file.Id); got != "hello" {
+		t.Errorf("got content %q, want %q", got, "hello")
+	}
+
+	// uploading to the same name adds a version to the file
+	again := upload(t, app, folderId, "notes.txt", "hello again")
+	if again.Id != file.Id {
+		t.Errorf("got file %s, want the existing %s", again.Id, file.Id)
+	}
+	if got := content(t, app, file.Id); got != "hello again" {
+		t.Errorf("got content %q, want %q", got, "hello again")
+	}
+
+	var fileVersions []models.FileVersion
+	if status := call(t, app, http.MethodGet, "/file/"+file.Id.String()+"/versions", nil, &fileVersions); status != http.StatusOK {
+		t.Fatalf("listing versions answered %d", status)
+	}
+	if len(fileVersions) != 2 {
+		t.Fatalf("got %d versions, want 2", len(fileVersions))
+	}
+	for _, version := range fileVersions {
+		if _, ok := server.Object(version.S3Key); !ok {
+			t.Errorf("the object of version %d is gone", version.VersionNumber)
+		}
+	}
+}
+
+func TestUploadEmptyFile(t *testing.T) {
+	app, _ := newApp(t)
+	folderId := createFolder(t, app, "Docs")
+
+	file := upload(t, app, folderId, "empty.txt", "")
+	if file.Size != 0 {
+		t.Errorf("got size %d, want 0", file.Size)
+	}
+	if got := content(t, app, file.Id); got != "" {
+		t.Errorf("got content %q, want none", got)
+	}
+}
+
+func TestCreateAndCompleteFile(t *testing.T) {
+	app, server := newApp(t)
+	folderId := createFolder(t, app, "Docs")
+
+	var file models.File
+	request := models.File{Name: "report.pdf", FolderId: folderId, UploadedBy: uuid.New()}
+	if status := call(t, app, http.MethodPost, "/file", request, &file); status != http.StatusCreated {
+		t.Fatalf("creating answered %d", status)
+	}
+	if file.Status != models.FileStatusPending || file.UploadURL == "" {
+		t.Fatalf("got status %q and upload URL %q, want a pending file to upload", file.Status, file.UploadURL)
+	}
+
+	complete := "/file/" + file.Id.String() + "/complete"
+	if status := call(t, app, http.MethodPost, complete, nil, nil); status != http.StatusConflict {
+		t.Errorf("completing before the upload answered %d, want %d", status, http.StatusConflict)
+	}
+
+	req, err := http.NewRequest(http.MethodPut, file.UploadURL, strings.NewReader("content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("uploading to the signed URL answered %d", resp.StatusCode)
+	}
+	if _, ok := server.Object(file.S3Key); !ok {
+		t.Fatalf("got objects %v, want %s", server.Objects(), file.S3Key)
+	}
+
+	var completed models.File
+	if status := call(t, app, http.MethodPost, complete, nil, &completed); status != http.StatusOK {
+		t.Fatalf("completing answered %d", status)
+	}
+	if completed.Status != models.FileStatusUploaded || completed.Size != 7 {
+		t.Errorf("got status %q and size %d, want uploaded and 7", completed.Status, completed.Size)
+	}
+
+	var download models.DownloadSignedURLResponse
+	if status := call(t, app, http.MethodGet, "/file/"+file.Id.String()+"/download", nil, &download); status != http.StatusOK {
+		t.Fatalf("getting a download URL answered %d", status)
+	}
+	resp, err = http.Get(download.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "content" {
+		t.Errorf("downloaded %q, want %q", data, "content")
+	}
+}
+
+func TestDeleteFile(t *testing.T) {
+	app, server := newApp(t)
+	folderId := createFolder(t, app, "Docs")
+
+	file := upload(t, app, folderId, "notes.txt", "old")
+	if status := call(t, app, http.MethodDelete, "/file/"+file.Id.String(), nil, nil); status != http.StatusOK {
+		t.Fatalf("deleting answered %d", status)
+	}
+	if status := call(t, app, http.MethodGet, "/file/"+file.Id.String(), nil, nil); status != http.StatusNotFound {
+		t.Errorf("getting a trashed file answered %d, want %d", status, http.StatusNotFound)
+	}
+
+	// the name is free again, and reusing it leaves the trashed content alone
+	reused := upload(t, app, folderId, "notes.txt", "new")
+	if reused.Id == file.Id {
+		t.Fatal("got the trashed file back")
+	}
+	if data, ok := server.Object(file.S3Key); !ok || string(data) != "old" {
+		t.Errorf("the trashed file's object holds %q, want %q", data, "old")
+	}
+	if got := content(t, app, reused.Id); got != "new" {
+		t.Errorf("got content %q, want %q", got, "new")
+	}
+}
@@ -0,0 +1,112 @@
+package files
+
+import (
+	"fm/models"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+func (h *handler) GetVersions(ctx fiber.Ctx) error {
+	id := ctx.Params("id")
+	fileId, err := uuid.Parse(id)
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	versions, serviceError := h.svc.GetVersions(ctx, &fileId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "File versions retrieved successfully",
+		Data:    versions,
+	})
+	return nil
+}
+
+func (h *handler) DownloadVersion(ctx fiber.Ctx) error {
+	fileId, versionId, ok := versionParams(ctx)
+	if !ok {
+		return nil
+	}
+
+	downloadResp, serviceError := h.svc.GetVersionDownloadURL(ctx, &fileId, &versionId, ctx.Query("disposition"))
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Download URL generated successfully",
+		Data:    downloadResp,
+	})
+	return nil
+}
+
+func (h *handler) RestoreVersion(ctx fiber.Ctx) error {
+	fileId, versionId, ok := versionParams(ctx)
+	if !ok {
+		return nil
+	}
+
+	fileResp, serviceError := h.svc.RestoreVersion(ctx, &fileId, &versionId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "File version restored successfully",
+		Data:    fileResp,
+	})
+	return nil
+}
+
+func (h *handler) DeleteVersion(ctx fiber.Ctx) error {
+	fileId, versionId, ok := versionParams(ctx)
+	if !ok {
+		return nil
+	}
+
+	versionResp, serviceError := h.svc.DeleteVersion(ctx, &fileId, &versionId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "File version deleted successfully",
+		Data:    versionResp,
+	})
+	return nil
+}
+
+// versionParams parses the :id and :versionId route parameters, answering
+// with 400 when either is not a UUID.
+func versionParams(ctx fiber.Ctx) (uuid.UUID, uuid.UUID, bool) {
+	fileId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	versionId, err := uuid.Parse(ctx.Params("versionId"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid version ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return uuid.Nil, uuid.Nil, false
+	}
+	return fileId, versionId, true
+}
@@ -1,8 +1,10 @@
 package folders
 
 import (
+	"fm/handler/listing"
 	"fm/models"
 	"fm/service"
+	"strconv"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
@@ -27,7 +29,7 @@ func (h *handlers) Create(ctx fiber.Ctx) error {
 		ctx.Status(statuscode).JSON(errResp)
 		return nil
 	}
-	folderResp, serviceError := h.svc.Create(ctx, &folder)
+	folderResp, created, serviceError := h.svc.Create(ctx, &folder, ctx.Query("on_conflict"))
 
 	if serviceError != nil {
 		statusCode, errResp := serviceError.ErrorResponse()
@@ -35,6 +37,15 @@ func (h *handlers) Create(ctx fiber.Ctx) error {
 		return nil
 	}
 
+	// overwriting hands back the folder that already had the name
+	if !created {
+		ctx.Status(fiber.StatusOK).JSON(models.Response{
+			Message: "Folder already exists",
+			Data:    folderResp,
+		})
+		return nil
+	}
+
 	ctx.Status(fiber.StatusCreated).JSON(models.Response{
 		Message: "Folder created successfully",
 		Data:    folderResp,
@@ -43,7 +54,14 @@ func (h *handlers) Create(ctx fiber.Ctx) error {
 }
 
 func (h *handlers) GetALL(ctx fiber.Ctx) error {
-	folders, serviceError := h.svc.GetALL(ctx)
+	opts, optsError := listing.Options(ctx, models.FolderSorts)
+	if optsError != nil {
+		statusCode, errResp := optsError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	folders, page, serviceError := h.svc.GetALL(ctx, opts)
 
 	if serviceError != nil {
 		statusCode, errResp := serviceError.ErrorResponse()
@@ -52,8 +70,10 @@ func (h *handlers) GetALL(ctx fiber.Ctx) error {
 	}
 
 	ctx.Status(fiber.StatusOK).JSON(models.Response{
-		Message: "Folders retrieved successfully",
-		Data:    folders,
+		Message:    "Folders retrieved successfully",
+		Data:       folders,
+		NextCursor: page.NextCursor,
+		Sort:       &page.Sort,
 	})
 	return nil
 }
@@ -89,8 +109,98 @@ func (h *handlers) GetSubFolders(ctx fiber.Ctx) error {
 		ctx.Status(statusCode).JSON(errResp)
 		return nil
 	}
-	folders, serviceError := h.svc.GetSubFolders(ctx, &folderId)
+	opts, optsError := listing.Options(ctx, models.FolderSorts)
+	if optsError != nil {
+		statusCode, errResp := optsError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	folders, page, serviceError := h.svc.GetSubFolders(ctx, &folderId, opts)
+
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message:    "Subfolders retrieved successfully",
+		Data:       folders,
+		NextCursor: page.NextCursor,
+		Sort:       &page.Sort,
+	})
+	return nil
+}
+
+// GetChildren lists the folders and files inside a folder, or at the root
+// when the route has no folder id.
+func (h *handlers) GetChildren(ctx fiber.Ctx) error {
+	var folderId *uuid.UUID
+	if id := ctx.Params("id"); id != "" {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid folder ID").ErrorResponse()
+			ctx.Status(statusCode).JSON(errResp)
+			return nil
+		}
+		folderId = &parsed
+	}
+
+	opts, optsError := listing.Options(ctx, models.FileSorts)
+	if optsError != nil {
+		statusCode, errResp := optsError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	includePending := ctx.Query("include_pending") == "true"
+
+	children, page, serviceError := h.svc.GetChildren(ctx, folderId, includePending, opts)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message:    "Folder contents retrieved successfully",
+		Data:       children,
+		NextCursor: page.NextCursor,
+		Sort:       &page.Sort,
+	})
+	return nil
+}
+
+// GetTree returns the nested folders below a folder, or the whole forest when
+// the route has no folder id. depth limits the levels returned and
+// include_files adds the files of the returned folders.
+func (h *handlers) GetTree(ctx fiber.Ctx) error {
+	var folderId *uuid.UUID
+	if id := ctx.Params("id"); id != "" {
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid folder ID").ErrorResponse()
+			ctx.Status(statusCode).JSON(errResp)
+			return nil
+		}
+		folderId = &parsed
+	}
+
+	depth := -1
+	if value := ctx.Query("depth"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			statusCode, errResp := httperrors.RequestValidationError(httperrors.InvalidQueryParam("depth")).ErrorResponse()
+			ctx.Status(statusCode).JSON(errResp)
+			return nil
+		}
+		depth = parsed
+	}
+
+	includeFiles := ctx.Query("include_files") == "true"
 
+	tree, serviceError := h.svc.GetTree(ctx, folderId, depth, includeFiles)
 	if serviceError != nil {
 		statusCode, errResp := serviceError.ErrorResponse()
 		ctx.Status(statusCode).JSON(errResp)
@@ -98,8 +208,109 @@ func (h *handlers) GetSubFolders(ctx fiber.Ctx) error {
 	}
 
 	ctx.Status(fiber.StatusOK).JSON(models.Response{
-		Message: "Subfolders retrieved successfully",
-		Data:    folders,
+		Message: "Folder tree retrieved successfully",
+		Data:    tree,
+	})
+	return nil
+}
+
+// Resolve returns the folder or file at the path given in the path query
+// parameter, along with its breadcrumbs.
+func (h *handlers) Resolve(ctx fiber.Ctx) error {
+	path := ctx.Query("path")
+	if path == "" {
+		statusCode, errResp := httperrors.RequestValidationError(httperrors.MissingQueryParam("path")).ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	resolved, serviceError := h.svc.Resolve(ctx, path)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Path resolved successfully",
+		Data:    resolved,
+	})
+	return nil
+}
+
+func (h *handlers) GetBreadcrumbs(ctx fiber.Ctx) error {
+	folderId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid folder ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	breadcrumbs, serviceError := h.svc.GetBreadcrumbs(ctx, &folderId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Breadcrumbs retrieved successfully",
+		Data:    breadcrumbs,
+	})
+	return nil
+}
+
+func (h *handlers) Delete(ctx fiber.Ctx) error {
+	id := ctx.Params("id")
+	folderId, err := uuid.Parse(id)
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid folder ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+	folderResp, serviceError := h.svc.Delete(ctx, &folderId)
+
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Folder moved to trash",
+		Data:    folderResp,
+	})
+	return nil
+}
+
+func (h *handlers) Update(ctx fiber.Ctx) error {
+	id := ctx.Params("id")
+	folderId, err := uuid.Parse(id)
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid folder ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	var patch models.FolderPatch
+	err = ctx.Bind().JSON(&patch)
+	if err != nil || (patch.Name == nil && patch.ParentID == nil && !patch.MoveToRoot) {
+		validationError := httperrors.BodyValidationError()
+		statuscode, errResp := validationError.ErrorResponse()
+		ctx.Status(statuscode).JSON(errResp)
+		return nil
+	}
+	folder, serviceError := h.svc.Update(ctx, &folderId, &patch)
+
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Folder updated successfully",
+		Data:    folder,
 	})
 	return nil
 }
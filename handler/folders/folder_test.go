@@ -0,0 +1,201 @@
+package folders_test
+
+import (
+	"bytes"
+	"encoding/json"
+	handlerFolders "fm/handler/folders"
+	"fm/models"
+	svcFolders "fm/service/folders"
+	"fm/store/buckets/memory"
+	"fm/store/files"
+	"fm/store/folders"
+	"fm/store/storetest"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+)
+
+// newApp serves the folder routes from a migrated database, keeping objects in
+// a memory bucket.
+func newApp(t *testing.T) (*fiber.App, interface{ Objects() []string }) {
+	t.Helper()
+
+	db := storetest.DB(t)
+	objects := memory.New("views")
+	handler := handlerFolders.New(svcFolders.New(folders.New(db), files.New(db), objects))
+
+	app := fiber.New()
+	app.Post("/folder", handler.Create)
+	app.Get("/folder/:id", handler.GetById)
+	app.Patch("/folder/:id", handler.Update)
+	app.Delete("/folder/:id", handler.Delete)
+	return app, objects
+}
+
+// call sends a request with body encoded as JSON and decodes the data of the
+// response into out, when given. It returns the status.
+func call(t *testing.T, app *fiber.App, method, path string, body, out any) int {
+	t.Helper()
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req, fiber.TestConfig{Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		response := models.Response{Data: out}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatalf("decoding the response to %s %s failed: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func create(t *testing.T, app *fiber.App, name string, parentId *uuid.UUID) *models.Folder {
+	t.Helper()
+
+	var folder models.Folder
+	status := call(t, app, http.MethodPost, "/folder", models.Folder{Name: name, ParentID: parentId, OwnerID: uuid.New()}, &folder)
+	if status != http.StatusCreated {
+		t.Fatalf("creating folder %q answered %d", name, status)
+	}
+	return &folder
+}
+
+func get(t *testing.T, app *fiber.App, id uuid.UUID) *models.Folder {
+	t.Helper()
+
+	var folder models.Folder
+	if status := call(t, app, http.MethodGet, "/folder/"+id.String(), nil, &folder); status != http.StatusOK {
+		t.Fatalf("getting folder %s answered %d", id, status)
+	}
+	return &folder
+}
+
+func TestCreateFolder(t *testing.T) {
+	app, objects := newApp(t)
+
+	docs := create(t, app, "Docs", nil)
+	if docs.FullPath != "/Docs" {
+		t.Errorf("got full path %q, want /Docs", docs.FullPath)
+	}
+	if !slices.Contains(objects.Objects(), "views/Docs/.keep") {
+		t.Errorf("got objects %v, want the folder marker", objects.Objects())
+	}
+
+	sub := create(t, app, "Sub", &docs.ID)
+	if sub.FullPath != "/Docs/Sub" {
+		t.Errorf("got full path %q, want /Docs/Sub", sub.FullPath)
+	}
+
+	duplicate := models.Folder{Name: "Docs", OwnerID: uuid.New()}
+	if status := call(t, app, http.MethodPost, "/folder", duplicate, nil); status != http.StatusConflict {
+		t.Errorf("creating a duplicate answered %d, want %d", status, http.StatusConflict)
+	}
+
+	var renamed models.Folder
+	if status := call(t, app, http.MethodPost, "/folder?on_conflict=rename", duplicate, &renamed); status != http.StatusCreated {
+		t.Fatalf("creating with on_conflict=rename answered %d", status)
+	}
+	if renamed.Name != "Docs (1)" {
+		t.Errorf("got name %q, want %q", renamed.Name, "Docs (1)")
+	}
+
+	var existing models.Folder
+	if status := call(t, app, http.MethodPost, "/folder?on_conflict=overwrite", duplicate, &existing); status != http.StatusOK {
+		t.Fatalf("creating with on_conflict=overwrite answered %d", status)
+	}
+	if existing.ID != docs.ID {
+		t.Errorf("got folder %s, want the existing %s", existing.ID, docs.ID)
+	}
+
+	if got := get(t, app, sub.ID); got.Name != "Sub" || got.ParentID == nil || *got.ParentID != docs.ID {
+		t.Errorf("got %+v, want Sub inside Docs", got)
+	}
+}
+
+func TestRenameAndMoveFolder(t *testing.T) {
+	app, objects := newApp(t)
+
+	docs := create(t, app, "Docs", nil)
+	sub := create(t, app, "Sub", &docs.ID)
+	archive := create(t, app, "Archive", nil)
+
+	name := "Papers"
+	if status := call(t, app, http.MethodPatch, "/folder/"+docs.ID.String(), models.FolderPatch{Name: &name}, nil); status != http.StatusOK {
+		t.Fatalf("renaming answered %d", status)
+	}
+	if got := get(t, app, sub.ID).FullPath; got != "/Papers/Sub" {
+		t.Errorf("got full path %q, want /Papers/Sub", got)
+	}
+	if !slices.Contains(objects.Objects(), "views/Papers/Sub/.keep") {
+		t.Errorf("got objects %v, want the markers moved along", objects.Objects())
+	}
+
+	// a folder can't go below itself
+	if status := call(t, app, http.MethodPatch, "/folder/"+docs.ID.String(), models.FolderPatch{ParentID: &sub.ID}, nil); status != http.StatusBadRequest {
+		t.Errorf("moving into a subfolder answered %d, want %d", status, http.StatusBadRequest)
+	}
+
+	if status := call(t, app, http.MethodPatch, "/folder/"+docs.ID.String(), models.FolderPatch{ParentID: &archive.ID}, nil); status != http.StatusOK {
+		t.Fatalf("moving answered %d", status)
+	}
+	if got := get(t, app, sub.ID).FullPath; got != "/Archive/Papers/Sub" {
+		t.Errorf("got full path %q, want /Archive/Papers/Sub", got)
+	}
+	for _, key := range objects.Objects() {
+		if strings.HasPrefix(key, "views/Papers/") {
+			t.Errorf("object %s was left behind", key)
+		}
+	}
+
+	// names are unique among siblings
+	other := create(t, app, "Other", &archive.ID)
+	if status := call(t, app, http.MethodPatch, "/folder/"+other.ID.String(), models.FolderPatch{Name: &name}, nil); status != http.StatusConflict {
+		t.Errorf("renaming onto a sibling answered %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestDeleteFolder(t *testing.T) {
+	app, objects := newApp(t)
+
+	docs := create(t, app, "Docs", nil)
+	create(t, app, "Sub", &docs.ID)
+
+	if status := call(t, app, http.MethodDelete, "/folder/"+docs.ID.String(), nil, nil); status != http.StatusOK {
+		t.Fatalf("deleting answered %d", status)
+	}
+	if status := call(t, app, http.MethodGet, "/folder/"+docs.ID.String(), nil, nil); status != http.StatusNotFound {
+		t.Errorf("getting a trashed folder answered %d, want %d", status, http.StatusNotFound)
+	}
+
+	// the objects leave the path, so the name can be used again
+	trashed := "views/.trash/" + docs.ID.String() + "/Sub/.keep"
+	if !slices.Contains(objects.Objects(), trashed) {
+		t.Errorf("got objects %v, want %s", objects.Objects(), trashed)
+	}
+	again := create(t, app, "Docs", nil)
+	if again.ID == docs.ID {
+		t.Error("got the trashed folder back")
+	}
+	create(t, app, "Sub", &again.ID)
+	if !slices.Contains(objects.Objects(), trashed) {
+		t.Errorf("the trashed objects were touched: %v", objects.Objects())
+	}
+}
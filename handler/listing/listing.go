@@ -0,0 +1,85 @@
+// Package listing reads the pagination, sort and filter query parameters shared
+// by the listing endpoints.
+package listing
+
+import (
+	"fm/models"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// Options reads limit, cursor, sort, order, name_prefix and the
+// created_after/created_before/updated_after/updated_before range, given as
+// RFC 3339 timestamps. sorts lists the sort fields the listing supports; the
+// default is name ascending.
+func Options(ctx fiber.Ctx, sorts []string) (*models.ListOptions, *httperrors.Error) {
+	opts := &models.ListOptions{
+		Limit:      models.DefaultPageLimit,
+		Cursor:     ctx.Query("cursor"),
+		Sort:       ctx.Query("sort", models.SortName),
+		Order:      ctx.Query("order", models.OrderAsc),
+		NamePrefix: ctx.Query("name_prefix"),
+	}
+
+	if limit := ctx.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > models.MaxPageLimit {
+			return nil, httperrors.RequestValidationError(httperrors.OutOfRange("limit", 1, models.MaxPageLimit))
+		}
+		opts.Limit = value
+	}
+	if !slices.Contains(sorts, opts.Sort) {
+		return nil, httperrors.RequestValidationError(httperrors.InvalidEnumValue("sort", sorts))
+	}
+	if !slices.Contains(models.SortOrders, opts.Order) {
+		return nil, httperrors.RequestValidationError(httperrors.InvalidEnumValue("order", models.SortOrders))
+	}
+
+	ranges := []struct {
+		param string
+		value **time.Time
+	}{
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+		{"updated_after", &opts.UpdatedAfter},
+		{"updated_before", &opts.UpdatedBefore},
+	}
+	for _, r := range ranges {
+		value := ctx.Query(r.param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, httperrors.RequestValidationError(httperrors.InvalidQueryParam(r.param))
+		}
+		*r.value = &parsed
+	}
+
+	return opts, nil
+}
+
+// FileOptions reads Options for file listings, which can also be filtered by
+// mime_type and uploaded_by.
+func FileOptions(ctx fiber.Ctx) (*models.ListOptions, *httperrors.Error) {
+	opts, err := Options(ctx, models.FileSorts)
+	if err != nil {
+		return nil, err
+	}
+
+	opts.MimeType = ctx.Query("mime_type")
+	if by := ctx.Query("uploaded_by"); by != "" {
+		uploadedBy, parseErr := uuid.Parse(by)
+		if parseErr != nil {
+			return nil, httperrors.RequestValidationError(httperrors.InvalidQueryParam("uploaded_by"))
+		}
+		opts.UploadedBy = &uploadedBy
+	}
+
+	return opts, nil
+}
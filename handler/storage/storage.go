@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"fm/store"
+	"io"
+	"net/url"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// handler serves the presigned URLs of storage drivers that don't have a
+// storage server of their own to send clients to.
+type handler struct {
+	server store.SignedURLServer
+}
+
+func New(s store.SignedURLServer) *handler {
+	return &handler{server: s}
+}
+
+func (h *handler) Upload(ctx fiber.Ctx) error {
+	key, params, ok := signedRequest(ctx)
+	if !ok {
+		return nil
+	}
+
+	var body io.Reader = ctx.Request().BodyStream()
+	if body == nil {
+		body = bytes.NewReader(ctx.Body())
+	}
+
+	if serviceError := h.server.ServeUpload(key, params, body); serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{"Key": key})
+}
+
+func (h *handler) Download(ctx fiber.Ctx) error {
+	key, params, ok := signedRequest(ctx)
+	if !ok {
+		return nil
+	}
+
+	body, headers, serviceError := h.server.ServeDownload(key, params)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	for name, value := range headers {
+		ctx.Set(name, value)
+	}
+	return ctx.Status(fiber.StatusOK).SendStream(body)
+}
+
+// signedRequest extracts the object key from the path and the signed
+// parameters from the query string, answering the request itself when
+// either is malformed.
+func signedRequest(ctx fiber.Ctx) (string, url.Values, bool) {
+	key, err := url.PathUnescape(ctx.Params("*"))
+	if err != nil || key == "" {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid object key").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return "", nil, false
+	}
+
+	params, err := url.ParseQuery(string(ctx.Request().URI().QueryString()))
+	if err != nil {
+		statusCode, errResp := httperrors.RequestValidationError(httperrors.InvalidQueryParam("signature")).ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return "", nil, false
+	}
+	return key, params, true
+}
@@ -0,0 +1,78 @@
+package trash
+
+import (
+	"fm/models"
+	"fm/service"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+type handler struct {
+	svc service.Trash
+}
+
+func New(s service.Trash) *handler {
+	return &handler{svc: s}
+}
+
+func (h *handler) List(ctx fiber.Ctx) error {
+	trashResp, serviceError := h.svc.List(ctx)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Trash retrieved successfully",
+		Data:    trashResp,
+	})
+	return nil
+}
+
+func (h *handler) Restore(ctx fiber.Ctx) error {
+	id, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid trash item ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	itemResp, serviceError := h.svc.Restore(ctx, id)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Restored from trash successfully",
+		Data:    itemResp,
+	})
+	return nil
+}
+
+func (h *handler) Delete(ctx fiber.Ctx) error {
+	id, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid trash item ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	itemResp, serviceError := h.svc.Delete(ctx, id)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Permanently deleted successfully",
+		Data:    itemResp,
+	})
+	return nil
+}
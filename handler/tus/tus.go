@@ -0,0 +1,177 @@
+package tus
+
+import (
+	"bytes"
+	"fm/models"
+	"fm/service"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// Implements the tus 1.0.0 resumable upload protocol with the creation,
+// termination and checksum extensions. See https://tus.io/protocols/resumable-upload
+const (
+	tusVersion         = "1.0.0"
+	tusExtensions      = "creation,termination,checksum"
+	statusChecksumFail = 460
+)
+
+type handler struct {
+	svc                service.TusUpload
+	checksumAlgorithms string
+	maxSize            int64
+}
+
+func New(s service.TusUpload, checksumAlgorithms []string, maxSize int64) *handler {
+	return &handler{svc: s, checksumAlgorithms: strings.Join(checksumAlgorithms, ","), maxSize: maxSize}
+}
+
+func (h *handler) Options(ctx fiber.Ctx) error {
+	ctx.Set("Tus-Resumable", tusVersion)
+	ctx.Set("Tus-Version", tusVersion)
+	ctx.Set("Tus-Extension", tusExtensions)
+	ctx.Set("Tus-Checksum-Algorithm", h.checksumAlgorithms)
+	if h.maxSize > 0 {
+		ctx.Set("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	}
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) Create(ctx fiber.Ctx) error {
+	if !h.checkVersion(ctx) {
+		return nil
+	}
+
+	length, err := strconv.ParseInt(ctx.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		statusCode, errResp := httperrors.HeaderValidationError(httperrors.InvalidHeader("Upload-Length")).ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+	if h.maxSize > 0 && length > h.maxSize {
+		statusCode, errResp := httperrors.New(codes.PayloadTooLarge, "Upload-Length exceeds Tus-Max-Size").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	upload, serviceError := h.svc.Create(ctx, length, ctx.Get("Upload-Metadata"))
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Set("Location", "/uploads/"+upload.Id.String())
+	ctx.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	return ctx.SendStatus(fiber.StatusCreated)
+}
+
+func (h *handler) Head(ctx fiber.Ctx) error {
+	ctx.Set("Cache-Control", "no-store")
+	if !h.checkVersion(ctx) {
+		return nil
+	}
+
+	uploadId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		return ctx.SendStatus(fiber.StatusNotFound)
+	}
+
+	upload, serviceError := h.svc.GetById(ctx, uploadId)
+	if serviceError != nil {
+		// HEAD responses carry no body
+		statusCode, _ := serviceError.ErrorResponse()
+		return ctx.SendStatus(statusCode)
+	}
+
+	ctx.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	ctx.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		ctx.Set("Upload-Metadata", upload.Metadata)
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+func (h *handler) Patch(ctx fiber.Ctx) error {
+	if !h.checkVersion(ctx) {
+		return nil
+	}
+
+	uploadId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.NotFound, "Upload not found").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	if ctx.Get(fiber.HeaderContentType) != "application/offset+octet-stream" {
+		statusCode, errResp := httperrors.New(codes.UnsupportedMediaType, "Content-Type must be application/offset+octet-stream").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	offset, err := strconv.ParseInt(ctx.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		statusCode, errResp := httperrors.HeaderValidationError(httperrors.InvalidHeader("Upload-Offset")).ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	var body io.Reader = ctx.Request().BodyStream()
+	if body == nil {
+		body = bytes.NewReader(ctx.Body())
+	}
+
+	upload, serviceError := h.svc.Write(ctx, uploadId, offset, body, ctx.Get("Upload-Checksum"))
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		if serviceError.Code == models.TusChecksumMismatch {
+			statusCode = statusChecksumFail
+		}
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *handler) Terminate(ctx fiber.Ctx) error {
+	if !h.checkVersion(ctx) {
+		return nil
+	}
+
+	uploadId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.NotFound, "Upload not found").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	if serviceError := h.svc.Terminate(ctx, uploadId); serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	return ctx.SendStatus(fiber.StatusNoContent)
+}
+
+// checkVersion sets Tus-Resumable on the response and rejects requests made
+// with another protocol version. It reports whether the request may proceed.
+func (h *handler) checkVersion(ctx fiber.Ctx) bool {
+	ctx.Set("Tus-Resumable", tusVersion)
+	if ctx.Get("Tus-Resumable") == tusVersion {
+		return true
+	}
+
+	ctx.Set("Tus-Version", tusVersion)
+	ctx.SendStatus(fiber.StatusPreconditionFailed)
+	return false
+}
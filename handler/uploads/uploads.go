@@ -0,0 +1,183 @@
+package uploads
+
+import (
+	"fm/models"
+	"fm/service"
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+type handler struct {
+	svc service.UploadSession
+}
+
+func New(s service.UploadSession) *handler {
+	return &handler{svc: s}
+}
+
+func (h *handler) Create(ctx fiber.Ctx) error {
+	fileId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid file ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	var req models.CreateUploadSessionRequest
+	err = ctx.Bind().JSON(&req)
+	if err != nil {
+		validationError := httperrors.BodyValidationError()
+		statuscode, errResp := validationError.ErrorResponse()
+		ctx.Status(statuscode).JSON(errResp)
+		return nil
+	}
+
+	session, serviceError := h.svc.Create(ctx, fileId, &req)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusCreated).JSON(models.Response{
+		Message: "Upload session created successfully",
+		Data:    session,
+	})
+	return nil
+}
+
+func (h *handler) GetById(ctx fiber.Ctx) error {
+	sessionId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid upload session ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	session, serviceError := h.svc.GetById(ctx, sessionId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Upload session retrieved successfully",
+		Data:    session,
+	})
+	return nil
+}
+
+func (h *handler) GetPartURL(ctx fiber.Ctx) error {
+	sessionId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid upload session ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+	partNumber, err := strconv.Atoi(ctx.Params("partNumber"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid part number").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	urlResp, serviceError := h.svc.GetPartURL(ctx, sessionId, partNumber)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Part upload URL generated successfully",
+		Data:    urlResp,
+	})
+	return nil
+}
+
+func (h *handler) CompletePart(ctx fiber.Ctx) error {
+	sessionId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid upload session ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+	partNumber, err := strconv.Atoi(ctx.Params("partNumber"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid part number").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	var part models.UploadPart
+	err = ctx.Bind().JSON(&part)
+	if err != nil {
+		validationError := httperrors.BodyValidationError()
+		statuscode, errResp := validationError.ErrorResponse()
+		ctx.Status(statuscode).JSON(errResp)
+		return nil
+	}
+	part.PartNumber = partNumber
+
+	session, serviceError := h.svc.CompletePart(ctx, sessionId, &part)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Part recorded successfully",
+		Data:    session,
+	})
+	return nil
+}
+
+func (h *handler) Complete(ctx fiber.Ctx) error {
+	sessionId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid upload session ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	file, serviceError := h.svc.Complete(ctx, sessionId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Upload completed successfully",
+		Data:    file,
+	})
+	return nil
+}
+
+func (h *handler) Abort(ctx fiber.Ctx) error {
+	sessionId, err := uuid.Parse(ctx.Params("id"))
+	if err != nil {
+		statusCode, errResp := httperrors.New(codes.BadRequest, "Invalid upload session ID").ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	session, serviceError := h.svc.Abort(ctx, sessionId)
+	if serviceError != nil {
+		statusCode, errResp := serviceError.ErrorResponse()
+		ctx.Status(statusCode).JSON(errResp)
+		return nil
+	}
+
+	ctx.Status(fiber.StatusOK).JSON(models.Response{
+		Message: "Upload session aborted successfully",
+		Data:    session,
+	})
+	return nil
+}
@@ -1,18 +1,39 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	handlerArchives "fm/handler/archives"
 	handlerFiles "fm/handler/files"
 	handlerFolders "fm/handler/folders"
+	handlerStorage "fm/handler/storage"
+	handlerTrash "fm/handler/trash"
+	handlerTus "fm/handler/tus"
+	handlerUploads "fm/handler/uploads"
+	svcArchives "fm/service/archives"
 	svcFiles "fm/service/files"
 	svcFolders "fm/service/folders"
+	"fm/service/reaper"
+	svcTrash "fm/service/trash"
+	svcTus "fm/service/tus"
+	svcUploads "fm/service/uploads"
 	"fm/store"
+	"fm/store/archives"
 	"fm/store/buckets"
+	localbucket "fm/store/buckets/local"
+	s3bucket "fm/store/buckets/s3"
 	"fm/store/files"
 	"fm/store/folders"
+	"fm/store/tus"
+	"fm/store/uploads"
+	"fm/store/versions"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
@@ -34,37 +55,300 @@ func main() {
 		log.Fatal("DB connection failed")
 	}
 	runMigrations(configs)
-	r := fiber.New()
-	bucket := buckets.New(
-		configs.GetConfig("S3_ENDPOINT"),
-		configs.GetConfig("S3_BUCKET"),
-		configs.GetConfig("S3_TOKEN"),
-	)
+
+	// "reconcile-rollups" repairs the cached folder counts and sizes, then exits
+	if len(os.Args) > 1 && os.Args[1] == "reconcile-rollups" {
+		reconcileRollups(db)
+		return
+	}
+
+	// request bodies are streamed so uploads proxied through the service are
+	// never held in memory as a whole
+	r := fiber.New(fiber.Config{StreamRequestBody: true})
+	bucket := initializeBucket(configs)
 	initializeFolderRoutes(r, db, bucket)
-	initializeFileRoutes(r, db, bucket)
+	initializeFileRoutes(r, db, bucket, configs)
+	initializeUploadRoutes(r, db, bucket)
+	initializeTusRoutes(r, db, bucket, configs)
+	initializeTrashRoutes(r, db, bucket)
+	initializeStorageRoutes(r, bucket)
+	archiveWorker := svcArchives.NewWorker(files.New(db), archives.New(db), bucket, archiveInterval(configs), archiveRetention(configs))
+	initializeArchiveRoutes(r, db, bucket, configs, archiveWorker)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	startUploadReaper(ctx, &workers, configs, db, bucket)
+	startTrashPurger(ctx, &workers, configs, db, bucket)
+	startArchiveWorker(ctx, &workers, archiveWorker)
+
+	go func() {
+		<-ctx.Done()
+		if err := r.Shutdown(); err != nil {
+			log.Println("Server shutdown failed:", err)
+		}
+	}()
+
+	if err := r.Listen(":" + configs.GetConfig("HTTP_PORT")); err != nil {
+		log.Println("Server stopped:", err)
+	}
+
+	stop()
+	workers.Wait()
+}
+
+// archiveInterval is how often the archive worker looks for jobs it was not
+// notified of, such as ones left behind by another instance.
+func archiveInterval(c *configManager.Config) time.Duration {
+	interval, err := strconv.Atoi(c.GetConfig("ARCHIVE_POLL_INTERVAL_SECONDS"))
+	if err != nil || interval <= 0 {
+		interval = 30
+	}
+	return time.Duration(interval) * time.Second
+}
+
+// archiveRetention is how long a finished archive job and its zip are kept.
+func archiveRetention(c *configManager.Config) time.Duration {
+	retention, err := strconv.Atoi(c.GetConfig("ARCHIVE_RETENTION_HOURS"))
+	if err != nil || retention <= 0 {
+		retention = 24
+	}
+	return time.Duration(retention) * time.Hour
+}
+
+// startArchiveWorker builds queued folder archives until ctx is done.
+func startArchiveWorker(ctx context.Context, workers *sync.WaitGroup, archiveWorker *svcArchives.Worker) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		archiveWorker.Run(ctx)
+	}()
+}
+
+// reconcileRollups recomputes the cached folder counts and sizes from the
+// files and folders tables.
+func reconcileRollups(db *sql.DB) {
+	fixed, err := folders.New(db).ReconcileRollups(context.Background())
+	if err != nil {
+		log.Fatal("Rollup reconciliation failed:", err)
+	}
+	log.Println("Rollup reconciliation fixed", fixed, "folders")
+}
+
+// startUploadReaper runs the background cleanup of abandoned uploads until ctx is done.
+func startUploadReaper(ctx context.Context, workers *sync.WaitGroup, c *configManager.Config, db *sql.DB, bucket store.Bucket) {
+	ttl, err := strconv.Atoi(c.GetConfig("UPLOAD_REAPER_TTL_MINUTES"))
+	if err != nil || ttl <= 0 {
+		ttl = 60
+	}
+
+	interval, err := strconv.Atoi(c.GetConfig("UPLOAD_REAPER_INTERVAL_MINUTES"))
+	if err != nil || interval <= 0 {
+		interval = 10
+	}
+
+	batchSize, err := strconv.Atoi(c.GetConfig("UPLOAD_REAPER_BATCH_SIZE"))
+	if err != nil || batchSize <= 0 {
+		batchSize = 100
+	}
+
+	uploadReaper := reaper.New(files.New(db), versions.New(db), uploads.New(db), tus.New(db), bucket, time.Duration(ttl)*time.Minute, time.Duration(interval)*time.Minute, batchSize)
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		uploadReaper.Run(ctx)
+	}()
+}
+
+// startTrashPurger runs the background removal of expired trash until ctx is done.
+func startTrashPurger(ctx context.Context, workers *sync.WaitGroup, c *configManager.Config, db *sql.DB, bucket store.Bucket) {
+	retention, err := strconv.Atoi(c.GetConfig("TRASH_RETENTION_DAYS"))
+	if err != nil || retention <= 0 {
+		retention = 30
+	}
+
+	interval, err := strconv.Atoi(c.GetConfig("TRASH_PURGE_INTERVAL_MINUTES"))
+	if err != nil || interval <= 0 {
+		interval = 60
+	}
 
-	r.Listen(":" + configs.GetConfig("HTTP_PORT"))
+	batchSize, err := strconv.Atoi(c.GetConfig("TRASH_PURGE_BATCH_SIZE"))
+	if err != nil || batchSize <= 0 {
+		batchSize = 100
+	}
+
+	trashPurger := svcTrash.NewPurger(folders.New(db), files.New(db), versions.New(db), bucket,
+		time.Duration(retention)*24*time.Hour, time.Duration(interval)*time.Minute, batchSize)
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		trashPurger.Run(ctx)
+	}()
 }
+
+// initializeBucket builds the storage backend selected by STORAGE_DRIVER:
+// "rest" (the default) for the storage REST API, "s3" for native S3 and
+// "local" for a directory on disk.
+func initializeBucket(c *configManager.Config) store.Bucket {
+	switch driver := c.GetConfig("STORAGE_DRIVER"); driver {
+	case "", "rest":
+		return buckets.New(
+			c.GetConfig("S3_ENDPOINT"),
+			c.GetConfig("S3_BUCKET"),
+			c.GetConfig("S3_TOKEN"),
+		)
+	case "s3":
+		forcePathStyle, _ := strconv.ParseBool(c.GetConfig("S3_FORCE_PATH_STYLE"))
+		bucket, err := s3bucket.New(
+			c.GetConfig("S3_REGION"),
+			c.GetConfig("S3_NATIVE_ENDPOINT"),
+			c.GetConfig("S3_BUCKET"),
+			c.GetConfig("S3_ACCESS_KEY_ID"),
+			c.GetConfig("S3_SECRET_ACCESS_KEY"),
+			forcePathStyle,
+		)
+		if err != nil {
+			log.Fatal("S3 storage setup failed:", err)
+		}
+		return bucket
+	case "local":
+		bucket, err := localbucket.New(
+			c.GetConfig("LOCAL_STORAGE_ROOT"),
+			c.GetConfig("S3_BUCKET"),
+			c.GetConfig("LOCAL_STORAGE_PUBLIC_URL"),
+			c.GetConfig("LOCAL_STORAGE_SECRET"),
+		)
+		if err != nil {
+			log.Fatal("Local storage setup failed:", err)
+		}
+		return bucket
+	default:
+		log.Fatal("Unknown STORAGE_DRIVER: ", driver)
+		return nil
+	}
+}
+
 func initializeFolderRoutes(app *fiber.App, db *sql.DB, bucket store.Bucket) {
 	folderStore := folders.New(db)
-	foldersvc := svcFolders.New(folderStore, bucket)
+	fileStore := files.New(db)
+	foldersvc := svcFolders.New(folderStore, fileStore, bucket)
 	folderHanlde := handlerFolders.New(foldersvc)
 
 	app.Post("/folder", folderHanlde.Create)
 	app.Get("/folder", folderHanlde.GetALL)
+	// registered before /folder/:id, which would take "children" and "tree" as ids
+	app.Get("/folder/children", folderHanlde.GetChildren)
+	app.Get("/folder/tree", folderHanlde.GetTree)
 	app.Get("/folder/:id", folderHanlde.GetById)
 	app.Get("/folder/:id/subfolders", folderHanlde.GetSubFolders)
+	app.Get("/folder/:id/children", folderHanlde.GetChildren)
+	app.Get("/folder/:id/tree", folderHanlde.GetTree)
+	app.Get("/folder/:id/breadcrumbs", folderHanlde.GetBreadcrumbs)
+	app.Get("/resolve", folderHanlde.Resolve)
+	app.Patch("/folder/:id", folderHanlde.Update)
+	app.Delete("/folder/:id", folderHanlde.Delete)
 }
 
-func initializeFileRoutes(app *fiber.App, db *sql.DB, bucket store.Bucket) {
+func initializeFileRoutes(app *fiber.App, db *sql.DB, bucket store.Bucket, configs *configManager.Config) {
 	fileStore := files.New(db)
 	folderStore := folders.New(db)
-	filesvc := svcFiles.New(fileStore, folderStore, bucket)
+	downloadExpiry, err := strconv.Atoi(configs.GetConfig("DOWNLOAD_URL_EXPIRY_SECONDS"))
+	if err != nil || downloadExpiry <= 0 {
+		downloadExpiry = 300
+	}
+	filesvc := svcFiles.New(fileStore, folderStore, versions.New(db), bucket, time.Duration(downloadExpiry)*time.Second)
 	fileHandler := handlerFiles.New(filesvc)
 
 	app.Post("/file", fileHandler.Create)
 	app.Get("/file/:id", fileHandler.GetById)
+	app.Get("/file/:id/download", fileHandler.Download)
+	app.Get("/file/:id/content", fileHandler.Content)
+	app.Post("/file/:id/complete", fileHandler.Complete)
+	app.Patch("/file/:id", fileHandler.Update)
+	app.Delete("/file/:id", fileHandler.Delete)
+	app.Get("/file/:id/versions", fileHandler.GetVersions)
+	app.Get("/file/:id/versions/:versionId/download", fileHandler.DownloadVersion)
+	app.Post("/file/:id/versions/:versionId/restore", fileHandler.RestoreVersion)
+	app.Delete("/file/:id/versions/:versionId", fileHandler.DeleteVersion)
 	app.Get("/folder/:folderId/files", fileHandler.GetFiles)
+	app.Put("/folder/:folderId/files/:name", fileHandler.Upload)
+}
+
+func initializeArchiveRoutes(app *fiber.App, db *sql.DB, bucket store.Bucket, configs *configManager.Config, worker *svcArchives.Worker) {
+	downloadExpiry, err := strconv.Atoi(configs.GetConfig("DOWNLOAD_URL_EXPIRY_SECONDS"))
+	if err != nil || downloadExpiry <= 0 {
+		downloadExpiry = 300
+	}
+	archivesvc := svcArchives.New(folders.New(db), archives.New(db), bucket, worker, time.Duration(downloadExpiry)*time.Second)
+	archiveHandler := handlerArchives.New(archivesvc)
+
+	app.Post("/folder/:id/archive", archiveHandler.Create)
+	app.Get("/jobs/:id", archiveHandler.GetById)
+}
+
+func initializeUploadRoutes(app *fiber.App, db *sql.DB, bucket store.Bucket) {
+	sessionStore := uploads.New(db)
+	fileStore := files.New(db)
+	filesvc := svcFiles.New(fileStore, folders.New(db), versions.New(db), bucket, 0)
+	uploadsvc := svcUploads.New(sessionStore, fileStore, filesvc, bucket)
+	uploadHandler := handlerUploads.New(uploadsvc)
+
+	app.Post("/file/:id/upload-sessions", uploadHandler.Create)
+	app.Get("/upload-sessions/:id", uploadHandler.GetById)
+	app.Get("/upload-sessions/:id/parts/:partNumber/url", uploadHandler.GetPartURL)
+	app.Put("/upload-sessions/:id/parts/:partNumber", uploadHandler.CompletePart)
+	app.Post("/upload-sessions/:id/complete", uploadHandler.Complete)
+	app.Delete("/upload-sessions/:id", uploadHandler.Abort)
+}
+
+func initializeTusRoutes(app *fiber.App, db *sql.DB, bucket store.Bucket, configs *configManager.Config) {
+	fileStore := files.New(db)
+	folderStore := folders.New(db)
+	filesvc := svcFiles.New(fileStore, folderStore, versions.New(db), bucket, 0)
+	tussvc := svcTus.New(tus.New(db), fileStore, filesvc, bucket)
+
+	maxSize, err := strconv.ParseInt(configs.GetConfig("TUS_MAX_SIZE"), 10, 64)
+	if err != nil {
+		maxSize = 0
+	}
+	tusHandler := handlerTus.New(tussvc, svcTus.ChecksumAlgorithms, maxSize)
+
+	app.Options("/uploads", tusHandler.Options)
+	app.Post("/uploads", tusHandler.Create)
+	app.Head("/uploads/:id", tusHandler.Head)
+	app.Patch("/uploads/:id", tusHandler.Patch)
+	app.Delete("/uploads/:id", tusHandler.Terminate)
+}
+
+func initializeTrashRoutes(app *fiber.App, db *sql.DB, bucket store.Bucket) {
+	folderStore := folders.New(db)
+	fileStore := files.New(db)
+	versionStore := versions.New(db)
+	foldersvc := svcFolders.New(folderStore, fileStore, bucket)
+	filesvc := svcFiles.New(fileStore, folderStore, versionStore, bucket, 0)
+	trashsvc := svcTrash.New(folderStore, fileStore, versionStore, foldersvc, filesvc, bucket)
+	trashHandler := handlerTrash.New(trashsvc)
+
+	app.Get("/trash", trashHandler.List)
+	app.Post("/trash/:id/restore", trashHandler.Restore)
+	app.Delete("/trash/:id", trashHandler.Delete)
+}
+
+// initializeStorageRoutes serves presigned URLs for storage drivers that
+// sign them for this service rather than for a storage server of their own.
+func initializeStorageRoutes(app *fiber.App, bucket store.Bucket) {
+	server, ok := bucket.(store.SignedURLServer)
+	if !ok {
+		return
+	}
+	storageHandler := handlerStorage.New(server)
+
+	app.Put("/storage/*", storageHandler.Upload)
+	app.Post("/storage/*", storageHandler.Upload)
+	app.Get("/storage/*", storageHandler.Download)
 }
 
 func runMigrations(configs *configManager.Config) {
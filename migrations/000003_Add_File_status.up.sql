@@ -0,0 +1,4 @@
+-- rows created before this migration are assumed to be uploaded
+ALTER TABLE files ADD COLUMN status TEXT NOT NULL DEFAULT 'uploaded'
+    CHECK (status IN ('pending', 'uploaded', 'failed'));
+ALTER TABLE files ALTER COLUMN status SET DEFAULT 'pending';
@@ -0,0 +1,22 @@
+CREATE TABLE upload_sessions (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    upload_id TEXT NOT NULL,  -- multipart upload id issued by the bucket
+    s3_key TEXT NOT NULL,
+    total_size BIGINT NOT NULL,
+    part_size BIGINT NOT NULL,
+    part_count INT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'completed', 'aborted')),
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    last_activity_at TIMESTAMPTZ NOT NULL DEFAULT now()  -- last part reported; keeps the file from being reaped
+);
+
+CREATE TABLE upload_parts (
+    session_id UUID NOT NULL REFERENCES upload_sessions(id) ON DELETE CASCADE,
+    part_number INT NOT NULL,
+    etag TEXT NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT now(),
+    PRIMARY KEY (session_id, part_number)
+);
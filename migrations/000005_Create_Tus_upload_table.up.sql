@@ -0,0 +1,14 @@
+CREATE TABLE tus_uploads (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    upload_id TEXT NOT NULL,  -- multipart upload id the chunks are staged under
+    s3_key TEXT NOT NULL,
+    upload_length BIGINT NOT NULL,
+    upload_offset BIGINT NOT NULL DEFAULT 0,
+    part_count INT NOT NULL DEFAULT 0,  -- staged parts of a fixed size
+    tail_size BIGINT NOT NULL DEFAULT 0, -- bytes staged after them that don't fill a part yet
+    metadata TEXT,            -- raw Upload-Metadata header
+    created_at TIMESTAMPTZ DEFAULT now(),
+    updated_at TIMESTAMPTZ DEFAULT now(),
+    last_activity_at TIMESTAMPTZ NOT NULL DEFAULT now()  -- last chunk received; keeps the file from being reaped
+);
@@ -0,0 +1 @@
+ALTER TABLE files ADD COLUMN checksum TEXT;  -- hex encoded SHA-256 of the object, when known
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS files_folder_id_name_key;
+DROP INDEX IF EXISTS folders_parent_id_name_key;
+ALTER TABLE folders ADD CONSTRAINT folders_name_key UNIQUE (name);
\ No newline at end of file
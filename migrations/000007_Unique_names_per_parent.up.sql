@@ -0,0 +1,55 @@
+-- names only have to be unique among siblings; root entries (NULL parent) are
+-- siblings of each other, hence the COALESCE to the nil UUID
+ALTER TABLE folders DROP CONSTRAINT IF EXISTS folders_name_key;
+CREATE UNIQUE INDEX folders_parent_id_name_key
+    ON folders (COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'), name);
+
+-- files never had a unique name, so siblings may already share one: the oldest
+-- keeps it and every other gets " (n)" before its extension, the way uploads
+-- name a copy. Their objects stay where they are, so a file still keyed by its
+-- path gets that path as its s3_key before the path changes. The rename has
+-- to run here, ahead of the index: a database that got the index can't hold
+-- duplicates anymore.
+DO $$
+DECLARE
+    duplicate RECORD;
+    extension TEXT;
+    candidate TEXT;
+    n INT;
+BEGIN
+    FOR duplicate IN
+        SELECT id, name, folder_id FROM (
+            SELECT id, name, folder_id, row_number() OVER (
+                PARTITION BY COALESCE(folder_id, '00000000-0000-0000-0000-000000000000'), name
+                ORDER BY created_at, id
+            ) AS rank
+            FROM files
+        ) ranked
+        WHERE rank > 1
+    LOOP
+        extension := COALESCE(substring(duplicate.name FROM '\.[^./]*$'), '');
+        IF extension = duplicate.name THEN
+            extension := '';
+        END IF;
+
+        n := 1;
+        LOOP
+            candidate := left(duplicate.name, length(duplicate.name) - length(extension)) || ' (' || n || ')' || extension;
+            EXIT WHEN NOT EXISTS (
+                SELECT 1 FROM files
+                WHERE COALESCE(folder_id, '00000000-0000-0000-0000-000000000000') = COALESCE(duplicate.folder_id, '00000000-0000-0000-0000-000000000000')
+                  AND name = candidate
+            );
+            n := n + 1;
+        END LOOP;
+
+        UPDATE files SET
+            s3_key = COALESCE(NULLIF(s3_key, ''), full_path),
+            full_path = left(full_path, length(full_path) - length(name)) || candidate,
+            name = candidate
+        WHERE id = duplicate.id;
+    END LOOP;
+END $$;
+
+CREATE UNIQUE INDEX files_folder_id_name_key
+    ON files (COALESCE(folder_id, '00000000-0000-0000-0000-000000000000'), name);
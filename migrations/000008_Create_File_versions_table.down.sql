@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS files_pending_version_id_idx;
+ALTER TABLE files DROP COLUMN IF EXISTS pending_version_id;
+ALTER TABLE files DROP COLUMN IF EXISTS current_version_id;
+DROP TABLE IF EXISTS file_versions;
@@ -0,0 +1,23 @@
+-- an overwrite is staged as a pending version, so the file keeps serving its
+-- current content until the upload completes; a pending version gets its
+-- number only once it is committed
+CREATE TABLE file_versions (
+    id UUID PRIMARY KEY,
+    file_id UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    version_number INT,
+    s3_key TEXT NOT NULL,  -- e.g. "views/.versions/<file id>/<version id>"
+    size BIGINT NOT NULL,
+    mime_type TEXT,
+    checksum TEXT,
+    uploaded_by UUID NOT NULL,
+    status TEXT NOT NULL DEFAULT 'uploaded' CHECK (status IN ('pending', 'uploaded')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (file_id, version_number),
+    CONSTRAINT file_versions_number_check CHECK ((status = 'pending') = (version_number IS NULL))
+);
+
+-- files uploaded before this migration have no version until they are first
+-- overwritten, at which point their content is kept as version 1
+ALTER TABLE files ADD COLUMN current_version_id UUID REFERENCES file_versions(id) ON DELETE SET NULL;
+ALTER TABLE files ADD COLUMN pending_version_id UUID REFERENCES file_versions(id) ON DELETE SET NULL;
+CREATE INDEX files_pending_version_id_idx ON files (updated_at) WHERE pending_version_id IS NOT NULL;
@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS files_deleted_at_idx;
+DROP INDEX IF EXISTS folders_deleted_at_idx;
+DELETE FROM files WHERE deleted_at IS NOT NULL;
+DELETE FROM folders WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS files_folder_id_name_key;
+CREATE UNIQUE INDEX files_folder_id_name_key
+    ON files (COALESCE(folder_id, '00000000-0000-0000-0000-000000000000'), name);
+DROP INDEX IF EXISTS folders_parent_id_name_key;
+CREATE UNIQUE INDEX folders_parent_id_name_key
+    ON folders (COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'), name);
+ALTER TABLE files DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE folders DROP COLUMN IF EXISTS deleted_at;
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- a set deleted_at means the row sits in the trash; rows below a trashed
+-- folder keep a NULL deleted_at and are hidden through their ancestor
+ALTER TABLE folders ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE files ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- trashed entries no longer hold on to their name
+DROP INDEX IF EXISTS folders_parent_id_name_key;
+CREATE UNIQUE INDEX folders_parent_id_name_key
+    ON folders (COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'), name)
+    WHERE deleted_at IS NULL;
+DROP INDEX IF EXISTS files_folder_id_name_key;
+CREATE UNIQUE INDEX files_folder_id_name_key
+    ON files (COALESCE(folder_id, '00000000-0000-0000-0000-000000000000'), name)
+    WHERE deleted_at IS NULL;
+
+CREATE INDEX folders_deleted_at_idx ON folders (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX files_deleted_at_idx ON files (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,18 @@
+DROP INDEX IF EXISTS folders_parent_id_updated_at_idx;
+DROP INDEX IF EXISTS folders_parent_id_created_at_idx;
+DROP INDEX IF EXISTS folders_parent_id_name_idx;
+
+DROP INDEX IF EXISTS files_folder_id_size_idx;
+DROP INDEX IF EXISTS files_folder_id_updated_at_idx;
+DROP INDEX IF EXISTS files_folder_id_created_at_idx;
+DROP INDEX IF EXISTS files_folder_id_name_idx;
+
+ALTER TABLE folders ALTER COLUMN updated_at DROP NOT NULL;
+ALTER TABLE folders ALTER COLUMN created_at DROP NOT NULL;
+
+ALTER TABLE files ALTER COLUMN updated_at DROP NOT NULL;
+ALTER TABLE files ALTER COLUMN updated_at DROP DEFAULT;
+ALTER TABLE files ALTER COLUMN created_at DROP NOT NULL;
+ALTER TABLE files ALTER COLUMN created_at DROP DEFAULT;
+ALTER TABLE files ALTER COLUMN size DROP NOT NULL;
+ALTER TABLE files ALTER COLUMN size DROP DEFAULT;
\ No newline at end of file
@@ -0,0 +1,24 @@
+-- listings are paged by (sort column, id), so the sort columns can't be NULL
+UPDATE files SET size = 0 WHERE size IS NULL;
+UPDATE files SET created_at = now() WHERE created_at IS NULL;
+UPDATE files SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE files ALTER COLUMN size SET DEFAULT 0;
+ALTER TABLE files ALTER COLUMN size SET NOT NULL;
+ALTER TABLE files ALTER COLUMN created_at SET DEFAULT now();
+ALTER TABLE files ALTER COLUMN created_at SET NOT NULL;
+ALTER TABLE files ALTER COLUMN updated_at SET DEFAULT now();
+ALTER TABLE files ALTER COLUMN updated_at SET NOT NULL;
+
+UPDATE folders SET created_at = now() WHERE created_at IS NULL;
+UPDATE folders SET updated_at = created_at WHERE updated_at IS NULL;
+ALTER TABLE folders ALTER COLUMN created_at SET NOT NULL;
+ALTER TABLE folders ALTER COLUMN updated_at SET NOT NULL;
+
+CREATE INDEX files_folder_id_name_idx ON files (folder_id, name, id) WHERE deleted_at IS NULL;
+CREATE INDEX files_folder_id_created_at_idx ON files (folder_id, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX files_folder_id_updated_at_idx ON files (folder_id, updated_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX files_folder_id_size_idx ON files (folder_id, size, id) WHERE deleted_at IS NULL;
+
+CREATE INDEX folders_parent_id_name_idx ON folders (parent_id, name, id) WHERE deleted_at IS NULL;
+CREATE INDEX folders_parent_id_created_at_idx ON folders (parent_id, created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX folders_parent_id_updated_at_idx ON folders (parent_id, updated_at, id) WHERE deleted_at IS NULL;
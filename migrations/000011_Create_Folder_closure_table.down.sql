@@ -0,0 +1 @@
+DROP TABLE IF EXISTS folder_closure;
\ No newline at end of file
@@ -0,0 +1,17 @@
+-- one row per folder and each of its ancestors, itself included at depth 0
+CREATE TABLE folder_closure (
+    ancestor_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    descendant_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    depth INT NOT NULL,
+    PRIMARY KEY (ancestor_id, descendant_id)
+);
+
+CREATE INDEX folder_closure_descendant_id_idx ON folder_closure (descendant_id, depth);
+
+WITH RECURSIVE paths AS (
+    SELECT id AS ancestor_id, id AS descendant_id, 0 AS depth FROM folders
+    UNION ALL
+    SELECT p.ancestor_id, f.id, p.depth + 1 FROM folders f JOIN paths p ON f.parent_id = p.descendant_id
+)
+INSERT INTO folder_closure (ancestor_id, descendant_id, depth)
+SELECT ancestor_id, descendant_id, depth FROM paths;
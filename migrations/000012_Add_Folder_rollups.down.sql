@@ -0,0 +1,19 @@
+DROP FUNCTION IF EXISTS reconcile_folder_rollups();
+
+DROP TRIGGER IF EXISTS folders_rollup_delete ON folders;
+DROP TRIGGER IF EXISTS folders_rollup_update ON folders;
+DROP TRIGGER IF EXISTS folders_rollup_insert ON folders;
+DROP FUNCTION IF EXISTS folders_rollup();
+
+DROP TRIGGER IF EXISTS files_rollup_delete ON files;
+DROP TRIGGER IF EXISTS files_rollup_update ON files;
+DROP TRIGGER IF EXISTS files_rollup_insert ON files;
+DROP FUNCTION IF EXISTS files_rollup();
+
+DROP FUNCTION IF EXISTS folder_rollup_add(UUID, BIGINT, BIGINT);
+
+ALTER TABLE folders
+    DROP COLUMN IF EXISTS total_bytes,
+    DROP COLUMN IF EXISTS total_file_count,
+    DROP COLUMN IF EXISTS subfolder_count,
+    DROP COLUMN IF EXISTS file_count;
\ No newline at end of file
@@ -0,0 +1,137 @@
+-- cached aggregates of the uploaded files and the folders inside a folder,
+-- leaving out anything in the trash; kept up to date by the triggers below
+ALTER TABLE folders
+    ADD COLUMN file_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN subfolder_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN total_file_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN total_bytes BIGINT NOT NULL DEFAULT 0;
+
+-- folder_rollup_add adds to the totals of p_folder and of the folders above
+-- it, up to and including the first one in the trash: a trashed folder keeps
+-- the totals of its contents but no longer counts towards its ancestors
+CREATE FUNCTION folder_rollup_add(p_folder UUID, p_files BIGINT, p_bytes BIGINT) RETURNS VOID AS $$
+    UPDATE folders SET total_file_count = total_file_count + p_files, total_bytes = total_bytes + p_bytes
+    WHERE (p_files <> 0 OR p_bytes <> 0) AND id IN (
+        SELECT c.ancestor_id FROM folder_closure c
+        WHERE c.descendant_id = p_folder
+        AND NOT EXISTS (
+            SELECT 1 FROM folder_closure b JOIN folders t ON t.id = b.ancestor_id
+            WHERE b.descendant_id = p_folder AND b.depth < c.depth AND t.deleted_at IS NOT NULL
+        )
+    );
+$$ LANGUAGE SQL;
+
+-- a file counts while it is uploaded, outside the trash and inside a folder;
+-- rows removed along with their folder leave nothing to update
+CREATE FUNCTION files_rollup() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        IF OLD.folder_id IS NOT NULL AND OLD.status = 'uploaded' AND OLD.deleted_at IS NULL
+            AND EXISTS (SELECT 1 FROM folders WHERE id = OLD.folder_id) THEN
+            UPDATE folders SET file_count = file_count - 1 WHERE id = OLD.folder_id;
+            PERFORM folder_rollup_add(OLD.folder_id, -1, -OLD.size);
+        END IF;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        IF NEW.folder_id IS NOT NULL AND NEW.status = 'uploaded' AND NEW.deleted_at IS NULL THEN
+            UPDATE folders SET file_count = file_count + 1 WHERE id = NEW.folder_id;
+            PERFORM folder_rollup_add(NEW.folder_id, 1, NEW.size);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER files_rollup_insert AFTER INSERT ON files
+    FOR EACH ROW EXECUTE FUNCTION files_rollup();
+CREATE TRIGGER files_rollup_update AFTER UPDATE OF folder_id, status, size, deleted_at ON files
+    FOR EACH ROW
+    WHEN (OLD.folder_id IS DISTINCT FROM NEW.folder_id OR OLD.status IS DISTINCT FROM NEW.status
+        OR OLD.size IS DISTINCT FROM NEW.size OR OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+    EXECUTE FUNCTION files_rollup();
+CREATE TRIGGER files_rollup_delete AFTER DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION files_rollup();
+
+-- a folder counts towards its parent, with its totals, while it is outside the trash
+CREATE FUNCTION folders_rollup() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP <> 'INSERT' THEN
+        IF OLD.parent_id IS NOT NULL AND OLD.deleted_at IS NULL
+            AND EXISTS (SELECT 1 FROM folders WHERE id = OLD.parent_id) THEN
+            UPDATE folders SET subfolder_count = subfolder_count - 1 WHERE id = OLD.parent_id;
+            PERFORM folder_rollup_add(OLD.parent_id, -OLD.total_file_count, -OLD.total_bytes);
+        END IF;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        IF NEW.parent_id IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            UPDATE folders SET subfolder_count = subfolder_count + 1 WHERE id = NEW.parent_id;
+            PERFORM folder_rollup_add(NEW.parent_id, NEW.total_file_count, NEW.total_bytes);
+        END IF;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER folders_rollup_insert AFTER INSERT ON folders
+    FOR EACH ROW EXECUTE FUNCTION folders_rollup();
+CREATE TRIGGER folders_rollup_update AFTER UPDATE OF parent_id, deleted_at ON folders
+    FOR EACH ROW
+    WHEN (OLD.parent_id IS DISTINCT FROM NEW.parent_id OR OLD.deleted_at IS DISTINCT FROM NEW.deleted_at)
+    EXECUTE FUNCTION folders_rollup();
+CREATE TRIGGER folders_rollup_delete AFTER DELETE ON folders
+    FOR EACH ROW EXECUTE FUNCTION folders_rollup();
+
+-- reconcile_folder_rollups recomputes every folder's rollups from scratch and
+-- returns how many folders were off
+CREATE FUNCTION reconcile_folder_rollups() RETURNS BIGINT AS $$
+DECLARE
+    fixed BIGINT;
+BEGIN
+    WITH direct_files AS (
+        SELECT folder_id AS id, count(*) AS n FROM files
+        WHERE folder_id IS NOT NULL AND status = 'uploaded' AND deleted_at IS NULL
+        GROUP BY folder_id
+    ),
+    direct_folders AS (
+        SELECT parent_id AS id, count(*) AS n FROM folders
+        WHERE parent_id IS NOT NULL AND deleted_at IS NULL
+        GROUP BY parent_id
+    ),
+    reach AS (
+        SELECT c.ancestor_id, c.descendant_id FROM folder_closure c
+        WHERE NOT EXISTS (
+            SELECT 1 FROM folder_closure b JOIN folders t ON t.id = b.ancestor_id
+            WHERE b.descendant_id = c.descendant_id AND b.depth < c.depth AND t.deleted_at IS NOT NULL
+        )
+    ),
+    totals AS (
+        SELECT r.ancestor_id AS id, count(*) AS n, SUM(fi.size) AS bytes
+        FROM reach r JOIN files fi ON fi.folder_id = r.descendant_id
+        WHERE fi.status = 'uploaded' AND fi.deleted_at IS NULL
+        GROUP BY r.ancestor_id
+    ),
+    expected AS (
+        SELECT f.id,
+            COALESCE(df.n, 0) AS file_count,
+            COALESCE(ds.n, 0) AS subfolder_count,
+            COALESCE(t.n, 0) AS total_file_count,
+            COALESCE(t.bytes, 0) AS total_bytes
+        FROM folders f
+        LEFT JOIN direct_files df ON df.id = f.id
+        LEFT JOIN direct_folders ds ON ds.id = f.id
+        LEFT JOIN totals t ON t.id = f.id
+    )
+    UPDATE folders f
+    SET file_count = e.file_count, subfolder_count = e.subfolder_count,
+        total_file_count = e.total_file_count, total_bytes = e.total_bytes
+    FROM expected e
+    WHERE f.id = e.id
+    AND (f.file_count, f.subfolder_count, f.total_file_count, f.total_bytes)
+        IS DISTINCT FROM (e.file_count, e.subfolder_count, e.total_file_count, e.total_bytes);
+
+    GET DIAGNOSTICS fixed = ROW_COUNT;
+    RETURN fixed;
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT reconcile_folder_rollups();
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS archive_jobs;
\ No newline at end of file
@@ -0,0 +1,19 @@
+CREATE TABLE archive_jobs (
+    id UUID PRIMARY KEY,
+    folder_id UUID NOT NULL REFERENCES folders(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    s3_key TEXT NOT NULL,      -- where the finished zip is written
+    file_name TEXT NOT NULL,   -- name offered when the zip is downloaded
+    files_total INT NOT NULL DEFAULT 0,
+    files_done INT NOT NULL DEFAULT 0,
+    bytes_total BIGINT NOT NULL DEFAULT 0,
+    bytes_done BIGINT NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    attempts INT NOT NULL DEFAULT 0,  -- times a worker has picked the job up
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    finished_at TIMESTAMPTZ
+);
+
+-- workers look for pending jobs and for running ones that stopped reporting progress
+CREATE INDEX archive_jobs_unfinished_idx ON archive_jobs (created_at) WHERE status IN ('pending', 'running');
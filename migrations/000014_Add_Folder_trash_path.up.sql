@@ -0,0 +1,4 @@
+-- a trashed folder's objects are moved out of its path, so that the path can
+-- be reused; trash_path is where they went. Folders trashed before this
+-- migration keep their objects in place and have no trash_path.
+ALTER TABLE folders ADD COLUMN trash_path TEXT;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS archive_jobs_finished_idx;
@@ -0,0 +1,2 @@
+-- finished jobs expire after the retention period, oldest first
+CREATE INDEX archive_jobs_finished_idx ON archive_jobs (finished_at) WHERE status IN ('completed', 'failed');
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ArchiveJob zips every file under a folder into a single object in the
+// bucket. Jobs are persisted so one interrupted by a restart is picked up
+// again; Download is only set once the job has completed.
+type ArchiveJob struct {
+	Id         uuid.UUID                  `json:"id"`
+	FolderId   uuid.UUID                  `json:"folder_id"`
+	Status     string                     `json:"status"`
+	S3Key      string                     `json:"-"`
+	FileName   string                     `json:"file_name"`
+	FilesTotal int                        `json:"files_total"`
+	FilesDone  int                        `json:"files_done"`
+	BytesTotal int64                      `json:"bytes_total"`
+	BytesDone  int64                      `json:"bytes_done"`
+	Error      string                     `json:"error,omitempty"`
+	Attempts   int                        `json:"-"`
+	Download   *DownloadSignedURLResponse `json:"download,omitempty"`
+	CreatedAt  time.Time                  `json:"created_at"`
+	UpdatedAt  time.Time                  `json:"updated_at"`
+	FinishedAt *time.Time                 `json:"finished_at,omitempty"`
+}
+
+const (
+	ArchiveJobPending   = "pending"
+	ArchiveJobRunning   = "running"
+	ArchiveJobCompleted = "completed"
+	ArchiveJobFailed    = "failed"
+)
+
+// ArchiveEntry is a file to add to an archive, at Path relative to the
+// archived folder.
+type ArchiveEntry struct {
+	Path string
+	File *File
+}
@@ -0,0 +1,20 @@
+package models
+
+// Kinds of entries inside a folder, used as the type of a Child or TrashItem.
+const (
+	ChildFolder = "folder"
+	ChildFile   = "file"
+)
+
+// Child is one entry of a folder's contents, either a folder or a file as
+// told by Type.
+type Child struct {
+	Type   string  `json:"type"`
+	Folder *Folder `json:"folder,omitempty"`
+	File   *File   `json:"file,omitempty"`
+	// ItemCount and TotalBytes are only set for folders: the number of entries
+	// directly inside and the size of all uploaded files below, at any depth,
+	// as kept in the folder's rollups.
+	ItemCount  *int   `json:"item_count,omitempty"`
+	TotalBytes *int64 `json:"total_bytes,omitempty"`
+}
@@ -0,0 +1,15 @@
+package models
+
+// Policies for creating a file or folder under a name its parent already
+// holds, picked with the on_conflict query parameter.
+const (
+	// ConflictFail rejects the create with 409 Conflict. It is the default.
+	ConflictFail = "fail"
+	// ConflictRename picks the first free name of the form "report (1).pdf".
+	ConflictRename = "rename"
+	// ConflictOverwrite replaces the existing file, or reuses the existing
+	// folder.
+	ConflictOverwrite = "overwrite"
+)
+
+var ConflictPolicies = []string{ConflictFail, ConflictRename, ConflictOverwrite}
@@ -3,4 +3,7 @@ package models
 type Response struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data"`
+	// NextCursor and Sort are only set on paginated listings
+	NextCursor string `json:"next_cursor,omitempty"`
+	Sort       *Sort  `json:"sort,omitempty"`
 }
@@ -18,4 +18,28 @@ type File struct {
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
 	UploadedBy uuid.UUID `json:"uploaded_by"`
+	Status     string    `json:"status"`
+	Checksum   string    `json:"checksum,omitempty"`
+	// CurrentVersionId is the version whose content the file's object holds.
+	// It is nil until the first upload completes.
+	CurrentVersionId *uuid.UUID `json:"current_version_id,omitempty"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
+	// PendingVersionId is the version a staged overwrite uploads to. It is
+	// nil unless an overwrite is in progress.
+	PendingVersionId *uuid.UUID `json:"pending_version_id,omitempty"`
+}
+
+// Upload lifecycle of a file: a row starts pending when its upload URL is
+// issued and becomes uploaded once the object is confirmed in the bucket.
+const (
+	FileStatusPending  = "pending"
+	FileStatusUploaded = "uploaded"
+	FileStatusFailed   = "failed"
+)
+
+// FilePatch carries the fields of a file rename or move. A nil field is left
+// unchanged.
+type FilePatch struct {
+	Name     *string    `json:"name,omitempty"`
+	FolderId *uuid.UUID `json:"folder_id,omitempty"`
 }
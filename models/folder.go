@@ -14,4 +14,20 @@ type Folder struct {
 	FullPath  string     `json:"full_path"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Rollups of the uploaded files and the folders inside, outside the trash.
+	// FileCount and SubfolderCount are direct children only; TotalFileCount and
+	// TotalBytes cover every level below.
+	FileCount      int   `json:"file_count"`
+	SubfolderCount int   `json:"subfolder_count"`
+	TotalFileCount int   `json:"total_file_count"`
+	TotalBytes     int64 `json:"total_bytes"`
+}
+
+// FolderPatch carries the fields of a folder rename or move. A nil field is
+// left unchanged; MoveToRoot moves the folder to the top level.
+type FolderPatch struct {
+	Name       *string    `json:"name,omitempty"`
+	ParentID   *uuid.UUID `json:"parent_id,omitempty"`
+	MoveToRoot bool       `json:"move_to_root,omitempty"`
 }
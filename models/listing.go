@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Fields listings can be sorted by, picked with the sort query parameter.
+const (
+	SortName      = "name"
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	// SortSize orders files by their size and folders by the total bytes
+	// below them.
+	SortSize = "size"
+)
+
+// Directions for the order query parameter.
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+var (
+	FolderSorts = []string{SortName, SortCreatedAt, SortUpdatedAt}
+	FileSorts   = []string{SortName, SortCreatedAt, SortUpdatedAt, SortSize}
+	SortOrders  = []string{OrderAsc, OrderDesc}
+)
+
+// Bounds for the limit query parameter.
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// ListOptions selects one page of a listing. Cursor is the next_cursor of the
+// previous page and only continues a listing in the same sort.
+// Unset filters don't restrict the listing.
+type ListOptions struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Order  string
+
+	NamePrefix string
+	// MimeType matches exactly, or every subtype when given as "image/*".
+	MimeType      string
+	UploadedBy    *uuid.UUID
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+}
+
+// Sort is the sort a listing was returned in.
+type Sort struct {
+	Field string `json:"field"`
+	Order string `json:"order"`
+}
+
+// Page describes a returned page of a listing. NextCursor is empty on the last
+// page.
+type Page struct {
+	NextCursor string
+	Sort       Sort
+}
@@ -0,0 +1,20 @@
+package models
+
+import "github.com/google/uuid"
+
+// Breadcrumb is one folder on the way from the root to an entry.
+type Breadcrumb struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	FullPath string    `json:"full_path"`
+}
+
+// Resolved is the folder or file found at a path, as told by Type.
+// Breadcrumbs lead from the root down to the folder the path ends in: the
+// folder itself, or the folder holding the file.
+type Resolved struct {
+	Type        string       `json:"type"`
+	Folder      *Folder      `json:"folder,omitempty"`
+	File        *File        `json:"file,omitempty"`
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+}
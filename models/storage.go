@@ -1,6 +1,10 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type CreateObjectResponse struct {
 	Key string    `json:"Key"`
@@ -12,3 +16,27 @@ type UploadSignedURLResponse struct {
 	Token string `json:"token"`
 	S3Key string `json:"s3Key"`
 }
+
+type DownloadOptions struct {
+	ExpiresIn   time.Duration
+	Disposition string
+	FileName    string
+	MimeType    string
+}
+
+type DownloadSignedURLResponse struct {
+	URL         string    `json:"url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Disposition string    `json:"disposition"`
+	FileName    string    `json:"file_name"`
+	MimeType    string    `json:"mime_type"`
+}
+
+// ObjectInfo is the metadata the bucket reports for a stored object.
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ContentType  string    `json:"content_type"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+}
@@ -0,0 +1,16 @@
+package models
+
+// Trash lists the entries that were moved to the trash. Only the trashed
+// entries themselves are listed, not the contents of trashed folders.
+type Trash struct {
+	Folders []Folder `json:"folders"`
+	Files   []*File  `json:"files"`
+}
+
+// TrashItem is a single folder or file taken out of the trash, either
+// restored or permanently deleted. Type is ChildFolder or ChildFile.
+type TrashItem struct {
+	Type   string  `json:"type"`
+	Folder *Folder `json:"folder,omitempty"`
+	File   *File   `json:"file,omitempty"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// Bounds for folder trees. A tree never holds more than MaxTreeNodes folders
+// and files; a bigger one is cut off and marked as truncated.
+const (
+	MaxTreeNodes = 10000
+)
+
+// TreeNode is a folder or file of a Tree. Folders carry their item count and
+// total size like a Child, and the nodes inside them as Children.
+type TreeNode struct {
+	Child
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// Tree is a nested view of folders, and optionally files. Truncated is set when
+// nodes were left out to stay within MaxTreeNodes; folders are kept over files
+// and shallow folders over deep ones.
+type Tree struct {
+	Nodes     []*TreeNode `json:"nodes"`
+	NodeCount int         `json:"node_count"`
+	Truncated bool        `json:"truncated"`
+}
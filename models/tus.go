@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TusUpload is the server side state of a tus resumable upload. The bytes
+// received so far are staged in the bucket as PartCount parts of a fixed size,
+// followed by a tail object of TailSize bytes that doesn't fill a part yet.
+type TusUpload struct {
+	Id        uuid.UUID `json:"id"`
+	FileId    uuid.UUID `json:"file_id"`
+	UploadId  string    `json:"-"`
+	S3Key     string    `json:"s3_key"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	PartCount int       `json:"part_count"`
+	TailSize  int64     `json:"tail_size"`
+	Metadata  string    `json:"metadata"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TusChecksumMismatch is the error code of a chunk whose Upload-Checksum
+// doesn't match, answered with the tus specific 460 status.
+const TusChecksumMismatch = "CHECKSUM_MISMATCH"
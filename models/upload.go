@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UploadSession tracks a multipart upload of a file. Sessions and their
+// completed parts are persisted so a client can resume after a crash.
+type UploadSession struct {
+	Id        uuid.UUID    `json:"id"`
+	FileId    uuid.UUID    `json:"file_id"`
+	UploadId  string       `json:"-"`
+	S3Key     string       `json:"s3_key"`
+	TotalSize int64        `json:"total_size"`
+	PartSize  int64        `json:"part_size"`
+	PartCount int          `json:"part_count"`
+	Status    string       `json:"status"`
+	Parts     []UploadPart `json:"parts"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+type UploadPart struct {
+	PartNumber int       `json:"part_number"`
+	ETag       string    `json:"etag"`
+	Size       int64     `json:"size"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateUploadSessionRequest struct {
+	TotalSize int64 `json:"total_size"`
+	PartSize  int64 `json:"part_size"`
+}
+
+const (
+	UploadSessionActive    = "active"
+	UploadSessionCompleted = "completed"
+	UploadSessionAborted   = "aborted"
+)
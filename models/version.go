@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FileVersion is one uploaded revision of a file. Every version keeps its
+// content under its own S3Key, and the file's s3_key points at the current
+// one, so an older version is restored by pointing the file back at it.
+type FileVersion struct {
+	Id            uuid.UUID `json:"id"`
+	FileId        uuid.UUID `json:"file_id"`
+	VersionNumber int       `json:"version_number"`
+	S3Key         string    `json:"s3_key"`
+	Size          int       `json:"size"`
+	MimeType      string    `json:"mime_type"`
+	Checksum      string    `json:"checksum,omitempty"`
+	UploadedBy    uuid.UUID `json:"uploaded_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	IsCurrent     bool      `json:"is_current"`
+}
+
+// An overwrite uploads to a pending version, which only joins the file's
+// versions once the upload completes.
+const (
+	VersionStatusPending  = "pending"
+	VersionStatusUploaded = "uploaded"
+)
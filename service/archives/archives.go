@@ -0,0 +1,88 @@
+package archives
+
+import (
+	"fm/models"
+	"fm/store"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// archivePrefix is where finished archives are written, outside any folder's
+// objects.
+const archivePrefix = "/.archives/"
+
+type service struct {
+	folderStore    store.Folder
+	jobStore       store.ArchiveJob
+	bucket         store.Bucket
+	worker         *Worker
+	downloadExpiry time.Duration
+}
+
+func New(folderStore store.Folder, jobStore store.ArchiveJob, bucket store.Bucket, worker *Worker, downloadExpiry time.Duration) *service {
+	return &service{
+		folderStore:    folderStore,
+		jobStore:       jobStore,
+		bucket:         bucket,
+		worker:         worker,
+		downloadExpiry: downloadExpiry,
+	}
+}
+
+// Create queues a zip of everything under the folder id and wakes the worker.
+// The job is returned as soon as it is queued; GetById reports its progress.
+func (s *service) Create(ctx fiber.Ctx, folderId *uuid.UUID) (*models.ArchiveJob, *httperrors.Error) {
+	folder, err := s.folderStore.GetById(ctx, folderId)
+	if err != nil {
+		return nil, err
+	}
+	trashed, err := s.folderStore.InTrash(ctx, folderId)
+	if err != nil {
+		return nil, err
+	}
+	if trashed {
+		return nil, httperrors.New(codes.NotFound, "Folder not found")
+	}
+
+	id := uuid.New()
+	job, err := s.jobStore.Create(ctx, &models.ArchiveJob{
+		Id:       id,
+		FolderId: folder.ID,
+		S3Key:    s.bucket.ObjectKey(archivePrefix + id.String() + ".zip"),
+		FileName: folder.Name + ".zip",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.worker.Notify()
+	return job, nil
+}
+
+// GetById returns the job with its progress and, once it has completed, a
+// presigned URL to download the zip.
+func (s *service) GetById(ctx fiber.Ctx, id uuid.UUID) (*models.ArchiveJob, *httperrors.Error) {
+	job, err := s.jobStore.GetById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.ArchiveJobCompleted {
+		return job, nil
+	}
+
+	download, err := s.bucket.GeneratePresignedDownloadURL(job.S3Key, models.DownloadOptions{
+		ExpiresIn:   s.downloadExpiry,
+		Disposition: "attachment",
+		FileName:    job.FileName,
+		MimeType:    "application/zip",
+	})
+	if err != nil {
+		return nil, err
+	}
+	job.Download = download
+	return job, nil
+}
@@ -0,0 +1,303 @@
+package archives
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fm/models"
+	"fm/store"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// progressInterval is how often a running job saves its progress, which
+	// doubles as its heartbeat.
+	progressInterval = 2 * time.Second
+	// staleAfter is how long a running job may go without saving progress
+	// before its worker is presumed dead and another one takes it over.
+	staleAfter = 5 * time.Minute
+	// maxAttempts bounds how often a job is started over after its worker
+	// died, so a folder that crashes the server can't do so forever.
+	maxAttempts = 3
+	// expireBatchSize bounds how many expired jobs are removed in one
+	// transaction.
+	expireBatchSize = 100
+)
+
+// errClaimLost stops a job that another worker has taken over.
+var errClaimLost = errors.New("archive job was taken over by another worker")
+
+// Worker builds the zips of archive jobs one at a time, streaming each file
+// from the bucket into a zip that is streamed back into the bucket. Jobs are
+// claimed from the database, so they survive restarts and can be shared by
+// several instances. Finished jobs are removed, zip included, once they are
+// older than the retention period.
+type Worker struct {
+	fileStore store.File
+	jobStore  store.ArchiveJob
+	bucket    store.Bucket
+	interval  time.Duration
+	retention time.Duration
+	wake      chan struct{}
+	built     atomic.Int64
+}
+
+func NewWorker(fileStore store.File, jobStore store.ArchiveJob, bucket store.Bucket, interval, retention time.Duration) *Worker {
+	return &Worker{
+		fileStore: fileStore,
+		jobStore:  jobStore,
+		bucket:    bucket,
+		interval:  interval,
+		retention: retention,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the worker to pick up a new job without waiting for the next
+// interval. It never blocks.
+func (w *Worker) Notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run works through runnable jobs at start, on every interval and whenever
+// notified, and removes expired ones, until ctx is cancelled. It blocks, so callers start it in its own
+// goroutine and wait for it to return on shutdown.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		w.drain(ctx)
+		w.expire(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Println("archive worker stopped, total built:", w.built.Load())
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// Built returns the number of archives completed since the worker started.
+func (w *Worker) Built() int64 {
+	return w.built.Load()
+}
+
+// drain claims and processes jobs until none are left or ctx is cancelled.
+func (w *Worker) drain(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := w.jobStore.Claim(ctx, time.Now().UTC().Add(-staleAfter))
+		if err != nil {
+			log.Println("archive worker failed to claim a job:", err)
+			return
+		}
+		if job == nil {
+			return
+		}
+		w.process(ctx, job)
+	}
+}
+
+// expire removes the jobs that finished more than the retention period ago,
+// together with their zips, until none are left or ctx is cancelled.
+func (w *Worker) expire(ctx context.Context) {
+	for ctx.Err() == nil {
+		removed, err := w.jobStore.DeleteExpired(ctx, time.Now().UTC().Add(-w.retention), expireBatchSize, func(job *models.ArchiveJob) error {
+			if err := w.bucket.DeleteObject(job.S3Key); err != nil {
+				return err
+			}
+			return nil
+		})
+		if err != nil {
+			log.Println("archive worker failed to remove expired jobs:", err)
+			return
+		}
+		if removed < expireBatchSize {
+			return
+		}
+	}
+}
+
+// process builds the job's zip and records the outcome. A job interrupted by
+// shutdown goes back to the queue for the next start.
+func (w *Worker) process(ctx context.Context, job *models.ArchiveJob) {
+	var err error
+	if job.Attempts > maxAttempts {
+		err = errors.New("archive was interrupted too many times")
+	} else {
+		err = w.build(ctx, job)
+	}
+
+	// the outcome is recorded even when shutdown has begun meanwhile
+	done := context.WithoutCancel(ctx)
+
+	switch {
+	case err == nil:
+		job.Status = models.ArchiveJobCompleted
+	case errors.Is(err, errClaimLost):
+		log.Println("archive worker lost job", job.Id)
+		return
+	case ctx.Err() != nil:
+		if err := w.jobStore.Release(done, job); err != nil {
+			log.Println("archive worker failed to release job", job.Id, err)
+		}
+		return
+	default:
+		job.Status = models.ArchiveJobFailed
+		job.Error = err.Error()
+	}
+
+	finished, err := w.jobStore.Finish(done, job)
+	if err != nil {
+		log.Println("archive worker failed to finish job", job.Id, err)
+		return
+	}
+	if !finished {
+		log.Println("archive worker lost job", job.Id)
+		return
+	}
+	if job.Status == models.ArchiveJobCompleted {
+		w.built.Add(1)
+	}
+}
+
+// build streams the zip of every file under the job's folder into the
+// bucket. The zip is written on one end of a pipe while the bucket reads the
+// other, so neither the archive nor any file is held in memory as a whole.
+func (w *Worker) build(ctx context.Context, job *models.ArchiveJob) error {
+	entries, err := w.fileStore.GetArchiveEntries(ctx, job.FolderId)
+	if err != nil {
+		return err
+	}
+
+	job.FilesTotal = len(entries)
+	job.BytesTotal = 0
+	for _, entry := range entries {
+		job.BytesTotal += int64(entry.File.Size)
+	}
+	p := &progress{ctx: ctx, jobStore: w.jobStore, job: job}
+	if err := p.save(); err != nil {
+		return err
+	}
+
+	reader, writer := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := w.write(ctx, p, entries, writer)
+		writer.CloseWithError(err)
+		written <- err
+	}()
+
+	uploadErr := w.bucket.PutObject(job.S3Key, reader, "application/zip")
+	// unblocks the writer when the upload gave up half way
+	reader.Close()
+
+	writeErr := <-written
+	if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+		return writeErr
+	}
+	if uploadErr != nil {
+		return uploadErr
+	}
+	return writeErr
+}
+
+// write zips entries into out, keeping their paths relative to the folder.
+func (w *Worker) write(ctx context.Context, p *progress, entries []models.ArchiveEntry, out io.Writer) error {
+	archive := zip.NewWriter(out)
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		dst, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     entry.Path,
+			Method:   zip.Deflate,
+			Modified: entry.File.UpdatedAt,
+		})
+		if err != nil {
+			return err
+		}
+
+		key := entry.File.S3Key
+		if key == "" {
+			key = entry.File.FullPath
+		}
+		src, getErr := w.bucket.GetObject(key, 0, -1)
+		if getErr != nil {
+			return getErr
+		}
+		_, err = io.Copy(dst, &progressReader{reader: src, progress: p})
+		src.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := p.add(1, 0); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return p.save()
+}
+
+// progress counts what a job has written so far and saves it every
+// progressInterval.
+type progress struct {
+	ctx      context.Context
+	jobStore store.ArchiveJob
+	job      *models.ArchiveJob
+	saved    time.Time
+}
+
+func (p *progress) add(files int, bytes int64) error {
+	p.job.FilesDone += files
+	p.job.BytesDone += bytes
+	if time.Since(p.saved) < progressInterval {
+		return nil
+	}
+	return p.save()
+}
+
+// save records the counters. Only a lost claim stops the job; a failed write
+// is retried on the next save rather than throwing away the work so far.
+func (p *progress) save() error {
+	saved, err := p.jobStore.SaveProgress(p.ctx, p.job)
+	if err != nil {
+		log.Println("archive worker failed to save progress of job", p.job.Id, err)
+		return nil
+	}
+	if !saved {
+		return errClaimLost
+	}
+	p.saved = time.Now()
+	return nil
+}
+
+// progressReader adds the bytes read from a file to its job's progress.
+type progressReader struct {
+	reader   io.Reader
+	progress *progress
+}
+
+func (r *progressReader) Read(buf []byte) (int, error) {
+	n, err := r.reader.Read(buf)
+	if n > 0 {
+		if progressErr := r.progress.add(0, int64(n)); progressErr != nil {
+			return n, progressErr
+		}
+	}
+	return n, err
+}
@@ -1,53 +1,491 @@
 package files
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fm/models"
+	svc "fm/service"
 	"fm/store"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
 	"github.com/syntaxLabz/errors/pkg/httperrors"
 )
 
 type service struct {
-	fileStore   store.File
-	folderStore store.Folder
-	bucket      store.Bucket
+	fileStore      store.File
+	folderStore    store.Folder
+	versionStore   store.FileVersion
+	bucket         store.Bucket
+	downloadExpiry time.Duration
 }
 
-func New(fileStore store.File, folderStore store.Folder, bucket store.Bucket) *service {
-	return &service{fileStore: fileStore, folderStore: folderStore, bucket: bucket}
+func New(fileStore store.File, folderStore store.Folder, versionStore store.FileVersion, bucket store.Bucket, downloadExpiry time.Duration) *service {
+	return &service{fileStore: fileStore, folderStore: folderStore, versionStore: versionStore, bucket: bucket, downloadExpiry: downloadExpiry}
 }
 
-func (s *service) Create(ctx fiber.Ctx, file *models.File) (*models.File, *httperrors.Error) {
-	var fullPath string
+// maxRenameAttempts bounds the numbered names tried by models.ConflictRename.
+const maxRenameAttempts = 100
 
-	if file.FolderId != uuid.Nil {
-		parentfolder, err := s.folderStore.GetById(ctx, &file.FolderId)
-		if err != nil {
+// Create registers a file and issues its upload URL. onConflict decides what
+// happens when the folder already holds a file of that name: fail, rename to
+// "report (1).pdf" and so on, or overwrite, which stages a new version of the
+// existing file with a fresh upload URL. Names are claimed by inserting the row,
+// so concurrent creates of the same name each end up with their own.
+func (s *service) Create(ctx fiber.Ctx, file *models.File, onConflict string) (*models.File, *httperrors.Error) {
+	switch onConflict {
+	case "":
+		onConflict = models.ConflictFail
+	case models.ConflictFail, models.ConflictRename, models.ConflictOverwrite:
+	default:
+		return nil, httperrors.RequestValidationError(httperrors.InvalidEnumValue("on_conflict", models.ConflictPolicies))
+	}
+
+	file.Status = models.FileStatusPending
+
+	name := file.Name
+	for attempt := 0; ; attempt++ {
+		if onConflict == models.ConflictRename && attempt > 0 {
+			file.Name = numberedName(name, attempt)
+		}
+
+		created, err := s.create(ctx, file)
+		if err == nil || err.Code != codes.Conflict || attempt == maxRenameAttempts {
+			return created, err
+		}
+
+		switch onConflict {
+		case models.ConflictRename:
+		case models.ConflictOverwrite:
+			existing, getErr := s.fileStore.GetByName(ctx, file.FolderId, file.Name)
+			if getErr == nil {
+				return s.overwrite(ctx, existing, file)
+			}
+			// the file was removed in between, so try to create it again
+			if getErr.Code != codes.NotFound {
+				return nil, getErr
+			}
+		default:
 			return nil, err
 		}
-		fullPath += parentfolder.FullPath + "/" + file.Name
-	} else {
-		fullPath = file.Name
 	}
-	fileObjectDetails, err := s.bucket.GeneratePresignedUploadURL(fullPath)
+}
+
+func (s *service) create(ctx fiber.Ctx, file *models.File) (*models.File, *httperrors.Error) {
+	fullPath, err := s.fullPath(ctx, file.FolderId, file.Name)
 	if err != nil {
 		return nil, err
 	}
-	file.FullPath = fileObjectDetails.S3Key
-	file.UploadURL = fileObjectDetails.URL
-	if file.Id == uuid.Nil {
-		file.Id = uuid.New()
-	}
 	file.Id = uuid.New()
+	fileObjectDetails, err := s.bucket.GeneratePresignedUploadURL(versionPath(file.Id))
+	if err != nil {
+		return nil, err
+	}
+	file.FullPath = s.bucket.ObjectKey(fullPath)
+	file.S3Key = fileObjectDetails.S3Key
+	file.UploadURL = fileObjectDetails.URL
 	return s.fileStore.Create(ctx, file)
 }
 
+// overwrite stages a pending version of existing for the upload described by
+// file. The file keeps serving its current version until the upload is
+// completed; a previously staged overwrite is discarded.
+func (s *service) overwrite(ctx fiber.Ctx, existing, file *models.File) (*models.File, *httperrors.Error) {
+	if err := s.keepUnversioned(ctx, existing); err != nil {
+		return nil, err
+	}
+	if err := s.discardPending(ctx, existing); err != nil {
+		return nil, err
+	}
+
+	fileObjectDetails, err := s.bucket.GeneratePresignedUploadURL(versionPath(existing.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.versionStore.Stage(ctx, &models.FileVersion{
+		FileId:     existing.Id,
+		S3Key:      fileObjectDetails.S3Key,
+		Size:       file.Size,
+		MimeType:   file.MimeType,
+		UploadedBy: file.UploadedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	existing.PendingVersionId = &version.Id
+	existing.UploadURL = fileObjectDetails.URL
+	if err := s.fileStore.StageUpload(ctx, existing); err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// numberedName returns name with " (n)" inserted before its extension.
+func numberedName(name string, n int) string {
+	extension := path.Ext(name)
+	if extension == name {
+		extension = ""
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, extension), n, extension)
+}
+
+// fullPath builds the bucket path of a file named name inside folderId.
+func (s *service) fullPath(ctx fiber.Ctx, folderId uuid.UUID, name string) (string, *httperrors.Error) {
+	if folderId == uuid.Nil {
+		return "/" + name, nil
+	}
+
+	parentfolder, err := s.folderStore.GetById(ctx, &folderId)
+	if err != nil {
+		return "", err
+	}
+	return parentfolder.FullPath + "/" + name, nil
+}
+
 func (s *service) GetById(ctx fiber.Ctx, id *uuid.UUID) (*models.File, *httperrors.Error) {
 	return s.fileStore.GetById(ctx, *id)
 }
 
-func (s *service) GetFiles(ctx fiber.Ctx, parentFolderId uuid.UUID) ([]*models.File, *httperrors.Error) {
-	return s.fileStore.GetFiles(ctx, parentFolderId)
+// GetFiles lists the files directly inside the folder parentFolderId, which
+// has to be outside the trash.
+func (s *service) GetFiles(ctx fiber.Ctx, parentFolderId uuid.UUID, includePending bool, opts *models.ListOptions) ([]*models.File, *models.Page, *httperrors.Error) {
+	if _, err := s.folderStore.GetById(ctx, &parentFolderId); err != nil {
+		return nil, nil, err
+	}
+	return s.fileStore.GetFiles(ctx, parentFolderId, includePending, opts)
+}
+
+// Delete moves the file to the trash. An object still kept under the file's
+// path is moved to a key of its own first, so the name can be reused right
+// away. It is permanently removed through the trash or once the retention
+// expires.
+func (s *service) Delete(ctx fiber.Ctx, id *uuid.UUID) (*models.File, *httperrors.Error) {
+	file, err := s.fileStore.GetById(ctx, *id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.detach(ctx, file); err != nil {
+		return nil, err
+	}
+	return s.fileStore.Trash(ctx, *id)
+}
+
+// Restore takes a file out of the trash. It goes back into its folder, or to
+// the root when the folder is no longer reachable.
+func (s *service) Restore(ctx fiber.Ctx, id *uuid.UUID) (*models.File, *httperrors.Error) {
+	file, err := s.fileStore.GetTrashedById(ctx, *id)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.FolderId != uuid.Nil {
+		inTrash, err := s.folderStore.InTrash(ctx, &file.FolderId)
+		if err != nil {
+			return nil, err
+		}
+		if inTrash {
+			file.FolderId = uuid.Nil
+		}
+	}
+
+	if err := s.relocate(ctx, file); err != nil {
+		return nil, err
+	}
+	if err := s.fileStore.Restore(ctx, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Update renames and/or moves a file. Only its path changes: the object keeps
+// its key, after being moved to a key of its own if it was still kept under a
+// path.
+func (s *service) Update(ctx fiber.Ctx, id *uuid.UUID, patch *models.FilePatch) (*models.File, *httperrors.Error) {
+	file, err := s.fileStore.GetById(ctx, *id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Name != nil {
+		if *patch.Name == "" || strings.Contains(*patch.Name, "/") {
+			return nil, httperrors.New(codes.BadRequest, "Invalid file name")
+		}
+		file.Name = *patch.Name
+	}
+	if patch.FolderId != nil {
+		file.FolderId = *patch.FolderId
+	}
+
+	if err := s.relocate(ctx, file); err != nil {
+		return nil, err
+	}
+	if err := s.fileStore.Update(ctx, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// relocate detaches the file's object from any path and points the file at
+// the path of its current folder and name.
+func (s *service) relocate(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	fullPath, err := s.fullPath(ctx, file.FolderId, file.Name)
+	if err != nil {
+		return err
+	}
+	if err := s.detach(ctx, file); err != nil {
+		return err
+	}
+	file.FullPath = s.bucket.ObjectKey(fullPath)
+	return nil
+}
+
+// GetDownloadURL returns a signed URL to read the file back from the bucket.
+// disposition is either "inline" (the default) or "attachment".
+func (s *service) GetDownloadURL(ctx fiber.Ctx, id *uuid.UUID, disposition string) (*models.DownloadSignedURLResponse, *httperrors.Error) {
+	switch disposition {
+	case "":
+		disposition = "inline"
+	case "inline", "attachment":
+	default:
+		return nil, httperrors.RequestValidationError(httperrors.InvalidEnumValue("disposition", []string{"inline", "attachment"}))
+	}
+
+	file, err := s.fileStore.GetById(ctx, *id)
+	if err != nil {
+		return nil, err
+	}
+
+	key := file.S3Key
+	if key == "" {
+		key = file.FullPath
+	}
+
+	return s.bucket.GeneratePresignedDownloadURL(key, models.DownloadOptions{
+		ExpiresIn:   s.downloadExpiry,
+		Disposition: disposition,
+		FileName:    file.Name,
+		MimeType:    file.MimeType,
+	})
+}
+
+// Complete confirms that the client finished uploading the file. The object
+// must exist in the bucket; its real size and content type replace whatever
+// the client declared on create. A declared size that doesn't match the stored
+// object marks the upload as failed. For a staged overwrite the file's pending
+// version is completed instead; a mismatching one is discarded and the file
+// keeps its current version.
+func (s *service) Complete(ctx fiber.Ctx, id *uuid.UUID) (*models.File, *httperrors.Error) {
+	file, err := s.fileStore.GetById(ctx, *id)
+	if err != nil {
+		return nil, err
+	}
+
+	if file.PendingVersionId != nil {
+		return s.completePending(ctx, file)
+	}
+
+	if file.Status == models.FileStatusUploaded {
+		return file, nil
+	}
+
+	key := file.S3Key
+	if key == "" {
+		key = file.FullPath
+	}
+
+	info, err := s.bucket.GetObjectInfo(key)
+	if err != nil {
+		if err.Code == codes.NotFound {
+			return nil, httperrors.New(codes.Conflict, "File has not been uploaded yet")
+		}
+		return nil, err
+	}
+
+	file.Status = models.FileStatusUploaded
+	if file.Size > 0 && int64(file.Size) != info.Size {
+		file.Status = models.FileStatusFailed
+	}
+	file.Size = int(info.Size)
+	if info.ContentType != "" {
+		file.MimeType = info.ContentType
+	}
+
+	if err := s.CommitUpload(ctx, file); err != nil {
+		return nil, err
+	}
+
+	if file.Status == models.FileStatusFailed {
+		return nil, httperrors.New(codes.Conflict, "Uploaded object size does not match the declared size")
+	}
+	return file, nil
+}
+
+func (s *service) completePending(ctx fiber.Ctx, file *models.File) (*models.File, *httperrors.Error) {
+	version, err := s.versionStore.GetPending(ctx, *file.PendingVersionId)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.bucket.GetObjectInfo(version.S3Key)
+	if err != nil {
+		if err.Code == codes.NotFound {
+			return nil, httperrors.New(codes.Conflict, "File has not been uploaded yet")
+		}
+		return nil, err
+	}
+
+	if version.Size > 0 && int64(version.Size) != info.Size {
+		if err := s.discardPending(ctx, file); err != nil {
+			return nil, err
+		}
+		return nil, httperrors.New(codes.Conflict, "Uploaded object size does not match the declared size")
+	}
+
+	file.Status = models.FileStatusUploaded
+	file.S3Key = version.S3Key
+	file.Size = int(info.Size)
+	file.MimeType = version.MimeType
+	if info.ContentType != "" {
+		file.MimeType = info.ContentType
+	}
+	file.UploadedBy = version.UploadedBy
+	file.Checksum = ""
+	if err := s.CommitUpload(ctx, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// discardPending removes the file's staged overwrite, if any, with its object.
+func (s *service) discardPending(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	if file.PendingVersionId == nil {
+		return nil
+	}
+
+	_, err := s.versionStore.DeletePending(ctx.Context(), *file.PendingVersionId, func(version *models.FileVersion) error {
+		if err := s.bucket.DeleteObject(version.S3Key); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	file.PendingVersionId = nil
+	return nil
+}
+
+// Upload streams body into the bucket as a file named name inside folderId.
+// The MIME type is sniffed from the first bytes and a SHA-256 is computed on
+// the way through. The content is stored under a key of its own first, and
+// only then recorded: as a new file, whose row claims the name in the same
+// step, or, when a file of that name exists, as its new current version. An
+// overwrite someone else has staged on the file is left alone.
+func (s *service) Upload(ctx fiber.Ctx, folderId uuid.UUID, name string, uploadedBy uuid.UUID, body io.Reader) (*models.File, *httperrors.Error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, httperrors.New(codes.BadRequest, "Invalid file name")
+	}
+
+	fullPath, err := s.fullPath(ctx, folderId, name)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 512)
+	n, readErr := io.ReadFull(body, head)
+	if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+		return nil, httperrors.New(codes.BadRequest, readErr.Error())
+	}
+	head = head[:n]
+	mimeType := http.DetectContentType(head)
+
+	file, err := s.fileStore.GetByName(ctx, folderId, name)
+	exists := err == nil
+	switch {
+	case exists:
+		if err := s.keepUnversioned(ctx, file); err != nil {
+			return nil, err
+		}
+	case err.Code == codes.NotFound:
+		file = &models.File{
+			Id:       uuid.New(),
+			Name:     name,
+			FolderId: folderId,
+			FullPath: s.bucket.ObjectKey(fullPath),
+		}
+	default:
+		return nil, err
+	}
+
+	digest := sha256.New()
+	counter := &svc.CountingReader{Reader: io.MultiReader(bytes.NewReader(head), body)}
+	key := s.bucket.ObjectKey(versionPath(file.Id))
+	if err := s.bucket.PutObject(key, io.TeeReader(counter, digest), mimeType); err != nil {
+		s.removeRejected(key)
+		return nil, err
+	}
+
+	version := &models.FileVersion{
+		Id:         uuid.New(),
+		FileId:     file.Id,
+		S3Key:      key,
+		Size:       int(counter.Count),
+		MimeType:   mimeType,
+		Checksum:   hex.EncodeToString(digest.Sum(nil)),
+		UploadedBy: uploadedBy,
+	}
+
+	if !exists {
+		file.Status = models.FileStatusUploaded
+		file.S3Key = key
+		file.Size = version.Size
+		file.MimeType = mimeType
+		file.Checksum = version.Checksum
+		file.UploadedBy = uploadedBy
+		// a concurrent upload of the same name that got its row in first
+		// wins, and this one is rejected by the unique name
+		if _, err := s.fileStore.CreateUploaded(ctx, file, version); err != nil {
+			s.removeRejected(key)
+			return nil, err
+		}
+		return file, nil
+	}
+
+	if err := s.fileStore.AddVersion(ctx, file, version); err != nil {
+		s.removeRejected(key)
+		return nil, err
+	}
+	return file, nil
+}
+
+// removeRejected deletes the object of an upload that could not be recorded.
+func (s *service) removeRejected(key string) {
+	if err := s.bucket.DeleteObject(key); err != nil {
+		log.Println("failed to remove rejected upload", key, err)
+	}
+}
+
+// OpenContent streams length bytes of the file's object starting at offset; a
+// negative length reads to the end. Only uploaded files have content.
+func (s *service) OpenContent(ctx fiber.Ctx, file *models.File, offset, length int64) (io.ReadCloser, *httperrors.Error) {
+	if file.Status != models.FileStatusUploaded {
+		return nil, httperrors.New(codes.Conflict, "File has not been uploaded yet")
+	}
+
+	key := file.S3Key
+	if key == "" {
+		key = file.FullPath
+	}
+	return s.bucket.GetObject(key, offset, length)
 }
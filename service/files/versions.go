@@ -0,0 +1,219 @@
+package files
+
+import (
+	"fm/models"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// Every upload writes to a key of its own under /.versions/<file id>/, which
+// doesn't depend on the file's path and so survives renames and moves. When
+// the upload completes, that object becomes a version as it is and the file's
+// s3_key points at it, so a version never costs a second copy of the content.
+
+// versionPath returns a fresh path for new content of the file id, to pass to
+// the bucket's ObjectKey or GeneratePresignedUploadURL.
+func versionPath(fileId uuid.UUID) string {
+	return fmt.Sprintf("/.versions/%s/%s", fileId, uuid.New())
+}
+
+// ownKey reports whether the file's object lives under a key of its own. Keys
+// derived from a path are not: the file's own path, for files uploaded before
+// content got keys of its own, or its place below a trashed folder.
+func (s *service) ownKey(file *models.File) bool {
+	return strings.HasPrefix(file.S3Key, s.bucket.ObjectKey("/.versions/"))
+}
+
+// CommitUpload persists the outcome of an upload. When the file ends up
+// uploaded, the object under its s3_key becomes the current version: the
+// staged pending version for an overwrite, a newly recorded one otherwise.
+func (s *service) CommitUpload(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	if file.Status == models.FileStatusUploaded {
+		version, err := s.record(ctx, file)
+		if err != nil {
+			return err
+		}
+		file.CurrentVersionId = &version.Id
+		file.PendingVersionId = nil
+	}
+	return s.fileStore.UpdateUploadStatus(ctx, file)
+}
+
+// UploadKey returns the key an upload to file writes to: that of its pending
+// version while an overwrite is staged, its own otherwise.
+func (s *service) UploadKey(ctx fiber.Ctx, file *models.File) (string, *httperrors.Error) {
+	if file.PendingVersionId != nil {
+		version, err := s.versionStore.GetPending(ctx, *file.PendingVersionId)
+		if err != nil {
+			return "", err
+		}
+		return version.S3Key, nil
+	}
+	if file.S3Key == "" {
+		return file.FullPath, nil
+	}
+	return file.S3Key, nil
+}
+
+// keepUnversioned records the content of a file uploaded before versioning
+// existed as its first version, so that overwriting it loses nothing. The
+// object is moved to a key of its own first.
+func (s *service) keepUnversioned(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	if file.Status != models.FileStatusUploaded || file.CurrentVersionId != nil {
+		return nil
+	}
+	return s.rekey(ctx, file, s.CommitUpload)
+}
+
+// detach moves an object kept under a key derived from a path to a key of its
+// own, so that the path can be reused or swept without touching the file.
+func (s *service) detach(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	if s.ownKey(file) {
+		return nil
+	}
+	if file.Status == models.FileStatusUploaded && file.CurrentVersionId == nil {
+		return s.keepUnversioned(ctx, file)
+	}
+	return s.rekey(ctx, file, s.fileStore.UpdateUploadStatus)
+}
+
+// rekey moves the file's object to a key of its own unless it already has one,
+// and saves the file with persist. The object is moved back if that fails.
+func (s *service) rekey(ctx fiber.Ctx, file *models.File, persist func(ctx fiber.Ctx, file *models.File) *httperrors.Error) *httperrors.Error {
+	if s.ownKey(file) {
+		return persist(ctx, file)
+	}
+
+	sourceKey := file.S3Key
+	if sourceKey == "" {
+		sourceKey = file.FullPath
+	}
+	key := s.bucket.ObjectKey(versionPath(file.Id))
+	if err := s.bucket.MoveObject(sourceKey, key); err != nil {
+		return err
+	}
+	file.S3Key = key
+	if err := persist(ctx, file); err != nil {
+		if moveErr := s.bucket.MoveObject(key, sourceKey); moveErr != nil {
+			log.Println("failed to move object back", key, sourceKey, moveErr)
+		}
+		file.S3Key = sourceKey
+		return err
+	}
+	return nil
+}
+
+// record adds the object under the file's s3_key as a new version, committing
+// the pending one when an overwrite is staged.
+func (s *service) record(ctx fiber.Ctx, file *models.File) (*models.FileVersion, *httperrors.Error) {
+	version := &models.FileVersion{
+		Id:         uuid.New(),
+		FileId:     file.Id,
+		S3Key:      file.S3Key,
+		Size:       file.Size,
+		MimeType:   file.MimeType,
+		Checksum:   file.Checksum,
+		UploadedBy: file.UploadedBy,
+	}
+	if file.PendingVersionId != nil {
+		version.Id = *file.PendingVersionId
+		return s.versionStore.Commit(ctx, version)
+	}
+	return s.versionStore.Create(ctx, version)
+}
+
+// GetVersions lists the versions of a file, newest first.
+func (s *service) GetVersions(ctx fiber.Ctx, id *uuid.UUID) ([]models.FileVersion, *httperrors.Error) {
+	if _, err := s.fileStore.GetById(ctx, *id); err != nil {
+		return nil, err
+	}
+	return s.versionStore.GetByFileIds(ctx, []uuid.UUID{*id})
+}
+
+// getVersion returns the version versionId, provided it belongs to file id.
+func (s *service) getVersion(ctx fiber.Ctx, id, versionId uuid.UUID) (*models.FileVersion, *httperrors.Error) {
+	version, err := s.versionStore.GetById(ctx, versionId)
+	if err != nil {
+		return nil, err
+	}
+	if version.FileId != id {
+		return nil, httperrors.New(codes.NotFound, "File version not found")
+	}
+	return version, nil
+}
+
+// GetVersionDownloadURL returns a signed URL to read one version of the file.
+// disposition is either "inline" (the default) or "attachment".
+func (s *service) GetVersionDownloadURL(ctx fiber.Ctx, id, versionId *uuid.UUID, disposition string) (*models.DownloadSignedURLResponse, *httperrors.Error) {
+	switch disposition {
+	case "":
+		disposition = "inline"
+	case "inline", "attachment":
+	default:
+		return nil, httperrors.RequestValidationError(httperrors.InvalidEnumValue("disposition", []string{"inline", "attachment"}))
+	}
+
+	file, err := s.fileStore.GetById(ctx, *id)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.getVersion(ctx, *id, *versionId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bucket.GeneratePresignedDownloadURL(version.S3Key, models.DownloadOptions{
+		ExpiresIn:   s.downloadExpiry,
+		Disposition: disposition,
+		FileName:    file.Name,
+		MimeType:    version.MimeType,
+	})
+}
+
+// RestoreVersion makes an older version current again by pointing the file
+// at its object. A staged overwrite is left in place.
+func (s *service) RestoreVersion(ctx fiber.Ctx, id, versionId *uuid.UUID) (*models.File, *httperrors.Error) {
+	file, err := s.fileStore.GetById(ctx, *id)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := s.getVersion(ctx, *id, *versionId)
+	if err != nil {
+		return nil, err
+	}
+	if version.IsCurrent && file.Status == models.FileStatusUploaded {
+		return file, nil
+	}
+
+	file.Status = models.FileStatusUploaded
+	file.S3Key = version.S3Key
+	file.Size = version.Size
+	file.MimeType = version.MimeType
+	file.Checksum = version.Checksum
+	file.UploadedBy = version.UploadedBy
+	file.CurrentVersionId = &version.Id
+	if err := s.fileStore.UpdateUploadStatus(ctx, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// DeleteVersion removes a version other than the current one, together with
+// its object.
+func (s *service) DeleteVersion(ctx fiber.Ctx, id, versionId *uuid.UUID) (*models.FileVersion, *httperrors.Error) {
+	if _, err := s.getVersion(ctx, *id, *versionId); err != nil {
+		return nil, err
+	}
+
+	return s.versionStore.Delete(ctx, *versionId, func(version *models.FileVersion) *httperrors.Error {
+		return s.bucket.DeleteObject(version.S3Key)
+	})
+}
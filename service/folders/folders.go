@@ -3,55 +3,96 @@ package folders
 import (
 	"fm/models"
 	"fm/store"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
 	"github.com/syntaxLabz/errors/pkg/httperrors"
 )
 
 type service struct {
 	folder store.Folder
+	file   store.File
 	bucket store.Bucket
 }
 
-func New(f store.Folder, b store.Bucket) *service {
+func New(f store.Folder, fl store.File, b store.Bucket) *service {
 	return &service{
 		folder: f,
+		file:   fl,
 		bucket: b,
 	}
 }
 
-func (s *service) Create(ctx fiber.Ctx, folder *models.Folder) (*models.Folder, *httperrors.Error) {
+// maxRenameAttempts bounds the numbered names tried by models.ConflictRename.
+const maxRenameAttempts = 100
 
-	var folderPath string
+// Create makes a folder inside folder.ParentID, or at the root. onConflict
+// decides what happens when a sibling already has the name: fail, rename to
+// "Docs (1)" and so on, or overwrite, which hands back the existing folder.
+// It reports whether a folder was created. Names are claimed by inserting the
+// row, so concurrent creates of the same name each end up with their own.
+func (s *service) Create(ctx fiber.Ctx, folder *models.Folder, onConflict string) (*models.Folder, bool, *httperrors.Error) {
+	switch onConflict {
+	case "":
+		onConflict = models.ConflictFail
+	case models.ConflictFail, models.ConflictRename, models.ConflictOverwrite:
+	default:
+		return nil, false, httperrors.RequestValidationError(httperrors.InvalidEnumValue("on_conflict", models.ConflictPolicies))
+	}
+
+	var parentPath string
 
 	// if parent exist append the path of parent
 	if folder.ParentID != nil {
-
 		parentFolder, err := s.folder.GetById(ctx, folder.ParentID)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
-
-		folderPath += parentFolder.FullPath
-
+		parentPath = parentFolder.FullPath
 	}
 	// in case no parent folder exist it will create normally and it will be a root folder
-	folderPath += "/" + folder.Name
 
-	// from the fullpath create the folder in bucket
-	folderObjectDetails, err := s.bucket.CreateFolder(folderPath)
-	if err != nil {
-		return nil, err
+	name := folder.Name
+	for attempt := 0; ; attempt++ {
+		if onConflict == models.ConflictRename && attempt > 0 {
+			folder.Name = fmt.Sprintf("%s (%d)", name, attempt)
+		}
+
+		created, err := s.create(ctx, folder, parentPath)
+		if err == nil {
+			return created, true, nil
+		}
+		if err.Code != codes.Conflict || attempt == maxRenameAttempts {
+			return nil, false, err
+		}
+
+		switch onConflict {
+		case models.ConflictRename:
+		case models.ConflictOverwrite:
+			existing, getErr := s.folder.GetByName(ctx, folder.ParentID, folder.Name)
+			if getErr == nil {
+				return existing, false, nil
+			}
+			// the sibling was removed in between, so try to create it again
+			if getErr.Code != codes.NotFound {
+				return nil, false, getErr
+			}
+		default:
+			return nil, false, err
+		}
 	}
+}
 
-	// Assigne folder values
-	folder.ID = folderObjectDetails.Id
-	log.Println(folderObjectDetails.Id)
-	log.Println(folder.ID)
-	folder.FullPath = folderPath
+// create claims the folder's name with its row, then writes the folder marker
+// to the bucket. The row is removed again if the marker can't be written.
+func (s *service) create(ctx fiber.Ctx, folder *models.Folder, parentPath string) (*models.Folder, *httperrors.Error) {
+	folder.ID = uuid.New()
+	folder.FullPath = parentPath + "/" + folder.Name
 	folder.CreatedAt = time.Now()
 	folder.UpdatedAt = time.Now()
 
@@ -60,15 +101,23 @@ func (s *service) Create(ctx fiber.Ctx, folder *models.Folder) (*models.Folder,
 		return nil, err
 	}
 
+	// from the fullpath create the folder in bucket
+	if _, err := s.bucket.CreateFolder(folder.FullPath); err != nil {
+		if deleteErr := s.folder.DeleteByIds(ctx, []uuid.UUID{folder.ID}); deleteErr != nil {
+			log.Println("failed to remove folder row without marker", folder.ID, deleteErr)
+		}
+		return nil, err
+	}
+
 	return folderResult, nil
 }
 
-func (s *service) GetALL(ctx fiber.Ctx) ([]models.Folder, *httperrors.Error) {
-	folders, err := s.folder.GetALL(ctx)
+func (s *service) GetALL(ctx fiber.Ctx, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error) {
+	folders, page, err := s.folder.GetALL(ctx, opts)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return folders, nil
+	return folders, page, nil
 }
 
 func (s *service) GetById(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error) {
@@ -79,10 +128,269 @@ func (s *service) GetById(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httper
 	return folder, nil
 }
 
-func (s *service) GetSubFolders(ctx fiber.Ctx, id *uuid.UUID) ([]models.Folder, *httperrors.Error) {
-	folders, err := s.folder.GetSubFolders(ctx, id)
+func (s *service) GetSubFolders(ctx fiber.Ctx, id *uuid.UUID, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error) {
+	folders, page, err := s.folder.GetSubFolders(ctx, id, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return folders, page, nil
+}
+
+// GetChildren lists the folders and files directly inside the folder id, or
+// at the root when id is nil.
+func (s *service) GetChildren(ctx fiber.Ctx, id *uuid.UUID, includePending bool, opts *models.ListOptions) ([]models.Child, *models.Page, *httperrors.Error) {
+	if id != nil {
+		if _, err := s.folder.GetById(ctx, id); err != nil {
+			return nil, nil, err
+		}
+	}
+	return s.folder.GetChildren(ctx, id, includePending, opts)
+}
+
+// GetTree returns the folders from id down, or the whole forest when id is
+// nil, nested up to depth levels; a negative depth doesn't limit them. With
+// includeFiles, the files inside the returned folders are added as well.
+func (s *service) GetTree(ctx fiber.Ctx, id *uuid.UUID, depth int, includeFiles bool) (*models.Tree, *httperrors.Error) {
+	if id != nil {
+		if _, err := s.folder.GetById(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	folders, truncated, err := s.folder.GetTree(ctx, id, depth, models.MaxTreeNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	// the forest's top-level folders are on level 1, below a virtual root
+	startLevel := 1
+	if id != nil {
+		startLevel = 0
+	}
+
+	tree := &models.Tree{Nodes: []*models.TreeNode{}, Truncated: truncated}
+	nodes := make(map[uuid.UUID]*models.TreeNode, len(folders))
+	levels := make(map[uuid.UUID]int, len(folders))
+	// parents lists the folders whose files fall within depth, in tree order
+	var parents []uuid.UUID
+	for _, folder := range folders {
+		node := &models.TreeNode{Child: folder}
+		nodes[folder.Folder.ID] = node
+
+		level := startLevel
+		var parent *models.TreeNode
+		if folder.Folder.ParentID != nil {
+			parent = nodes[*folder.Folder.ParentID]
+		}
+		if parent != nil {
+			parent.Children = append(parent.Children, node)
+			level = levels[parent.Folder.ID] + 1
+		} else {
+			tree.Nodes = append(tree.Nodes, node)
+		}
+		levels[folder.Folder.ID] = level
+
+		if depth < 0 || level < depth {
+			parents = append(parents, folder.Folder.ID)
+		}
+	}
+	tree.NodeCount = len(folders)
+
+	if !includeFiles || tree.Truncated {
+		return tree, nil
+	}
+
+	includeRoot := id == nil && depth != 0
+	if len(parents) == 0 && !includeRoot {
+		return tree, nil
+	}
+
+	budget := models.MaxTreeNodes - tree.NodeCount
+	files, err := s.file.GetTreeFiles(ctx, parents, includeRoot, budget+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > budget {
+		files = files[:budget]
+		tree.Truncated = true
+	}
+
+	for _, file := range files {
+		node := &models.TreeNode{Child: models.Child{Type: models.ChildFile, File: file}}
+		if parent, ok := nodes[file.FolderId]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			tree.Nodes = append(tree.Nodes, node)
+		}
+	}
+	tree.NodeCount += len(files)
+
+	return tree, nil
+}
+
+// Resolve returns the folder or file at path, a "/" separated chain of names
+// from the root such as "Root/Projects/Design/spec.pdf". Leading and trailing
+// slashes don't matter, so folder paths, which start with "/", resolve as they
+// are. A file's full_path starts with the bucket name instead, which is
+// dropped when the path doesn't resolve with it. A folder wins over a file of
+// the same name.
+func (s *service) Resolve(ctx fiber.Ctx, path string) (*models.Resolved, *httperrors.Error) {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, httperrors.RequestValidationError(httperrors.InvalidQueryParam("path"))
+	}
+
+	resolved, err := s.resolve(ctx, names)
+	bucketName := strings.Trim(s.bucket.ObjectKey(""), "/")
+	if err != nil && err.Code == codes.NotFound && len(names) > 1 && names[0] == bucketName {
+		resolved, err = s.resolve(ctx, names[1:])
+	}
+	return resolved, err
+}
+
+func (s *service) resolve(ctx fiber.Ctx, names []string) (*models.Resolved, *httperrors.Error) {
+	folders, err := s.folder.WalkPath(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	breadcrumbs := make([]models.Breadcrumb, 0, len(folders))
+	for _, folder := range folders {
+		breadcrumbs = append(breadcrumbs, models.Breadcrumb{ID: folder.ID, Name: folder.Name, FullPath: folder.FullPath})
+	}
+
+	switch len(folders) {
+	case len(names):
+		folder := folders[len(folders)-1]
+		return &models.Resolved{Type: models.ChildFolder, Folder: &folder, Breadcrumbs: breadcrumbs}, nil
+	case len(names) - 1:
+		var folderId uuid.UUID
+		if len(folders) > 0 {
+			folderId = folders[len(folders)-1].ID
+		}
+		file, err := s.file.GetByName(ctx, folderId, names[len(names)-1])
+		if err != nil {
+			if err.Code == codes.NotFound {
+				return nil, httperrors.New(codes.NotFound, "Path not found")
+			}
+			return nil, err
+		}
+		return &models.Resolved{Type: models.ChildFile, File: file, Breadcrumbs: breadcrumbs}, nil
+	}
+	return nil, httperrors.New(codes.NotFound, "Path not found")
+}
+
+// GetBreadcrumbs returns the folders from the root down to the folder id.
+func (s *service) GetBreadcrumbs(ctx fiber.Ctx, id *uuid.UUID) ([]models.Breadcrumb, *httperrors.Error) {
+	return s.folder.GetBreadcrumbs(ctx, id)
+}
+
+// Delete moves the folder, and with it everything below, to the trash. Its
+// objects go below a path of their own in the bucket, so the folder's name can
+// be reused right away. It is permanently removed through the trash or once
+// the retention expires.
+func (s *service) Delete(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error) {
+	var folder *models.Folder
+	err := s.moving(func(move func(oldPath, newPath string) *httperrors.Error) *httperrors.Error {
+		var err *httperrors.Error
+		folder, err = s.folder.Trash(ctx, id, trashPath(*id), move)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// trashPath is where the objects of the trashed folder id are kept.
+func trashPath(id uuid.UUID) string {
+	return "/.trash/" + id.String()
+}
+
+// Restore takes a folder out of the trash. It goes back into its parent, or
+// to the root when the parent is no longer reachable.
+func (s *service) Restore(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error) {
+	var folder *models.Folder
+	err := s.moving(func(move func(oldPath, newPath string) *httperrors.Error) *httperrors.Error {
+		var err *httperrors.Error
+		folder, err = s.folder.Restore(ctx, id, move)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return folder, nil
+}
+
+// Update renames and/or moves a folder. The new full_path is propagated to all
+// descendant folders and files inside the same transaction, and everything
+// stored below the old path in the bucket is moved along before it commits.
+func (s *service) Update(ctx fiber.Ctx, id *uuid.UUID, patch *models.FolderPatch) (*models.Folder, *httperrors.Error) {
+	// folders in the trash can't be changed
+	folder, err := s.folder.GetById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.Name != nil {
+		if *patch.Name == "" || strings.Contains(*patch.Name, "/") {
+			return nil, httperrors.New(codes.BadRequest, "Invalid folder name")
+		}
+		folder.Name = *patch.Name
+	}
+
+	switch {
+	case patch.MoveToRoot:
+		folder.ParentID = nil
+	case patch.ParentID != nil:
+		if *patch.ParentID == folder.ID {
+			return nil, httperrors.New(codes.BadRequest, "Folder cannot be moved into its own subtree")
+		}
+		// the new parent can't be in the trash
+		if _, err := s.folder.GetById(ctx, patch.ParentID); err != nil {
+			return nil, err
+		}
+		folder.ParentID = patch.ParentID
+	}
+
+	err = s.moving(func(move func(oldPath, newPath string) *httperrors.Error) *httperrors.Error {
+		return s.folder.UpdateTree(ctx, folder, move)
+	})
 	if err != nil {
 		return nil, err
 	}
-	return folders, nil
-}
\ No newline at end of file
+
+	return folder, nil
+}
+
+// moving runs a store change that moves the objects below a folder path with
+// the move it is handed, inside its transaction. The paths are only known
+// there, so a move that made it to the bucket is undone here if the change
+// then fails to commit.
+func (s *service) moving(change func(move func(oldPath, newPath string) *httperrors.Error) *httperrors.Error) *httperrors.Error {
+	var movedFrom, movedTo string
+	err := change(func(oldPath, newPath string) *httperrors.Error {
+		if err := s.bucket.MoveFolder(oldPath, newPath); err != nil {
+			s.revertMove(newPath, oldPath)
+			return err
+		}
+		movedFrom, movedTo = oldPath, newPath
+		return nil
+	})
+	if err != nil && movedTo != "" {
+		s.revertMove(movedTo, movedFrom)
+	}
+	return err
+}
+
+// revertMove moves whatever already reached newPath back to oldPath.
+func (s *service) revertMove(newPath, oldPath string) {
+	if err := s.bucket.MoveFolder(newPath, oldPath); err != nil {
+		log.Println("failed to move folder objects back", newPath, oldPath, err)
+	}
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"fm/models"
+	"io"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
@@ -9,16 +10,63 @@ import (
 )
 
 type File interface {
-	Create(ctx fiber.Ctx, file *models.File) (*models.File, *httperrors.Error)
+	Create(ctx fiber.Ctx, file *models.File, onConflict string) (*models.File, *httperrors.Error)
 	GetById(ctx fiber.Ctx, id *uuid.UUID) (*models.File, *httperrors.Error)
-	GetFiles(ctx fiber.Ctx, parentFolderId uuid.UUID) ([]*models.File, *httperrors.Error)
+	GetFiles(ctx fiber.Ctx, parentFolderId uuid.UUID, includePending bool, opts *models.ListOptions) ([]*models.File, *models.Page, *httperrors.Error)
+	Delete(ctx fiber.Ctx, id *uuid.UUID) (*models.File, *httperrors.Error)
+	Restore(ctx fiber.Ctx, id *uuid.UUID) (*models.File, *httperrors.Error)
+	Update(ctx fiber.Ctx, id *uuid.UUID, patch *models.FilePatch) (*models.File, *httperrors.Error)
+	GetDownloadURL(ctx fiber.Ctx, id *uuid.UUID, disposition string) (*models.DownloadSignedURLResponse, *httperrors.Error)
+	Complete(ctx fiber.Ctx, id *uuid.UUID) (*models.File, *httperrors.Error)
+	Upload(ctx fiber.Ctx, folderId uuid.UUID, name string, uploadedBy uuid.UUID, body io.Reader) (*models.File, *httperrors.Error)
+	OpenContent(ctx fiber.Ctx, file *models.File, offset, length int64) (io.ReadCloser, *httperrors.Error)
+	CommitUpload(ctx fiber.Ctx, file *models.File) *httperrors.Error
+	UploadKey(ctx fiber.Ctx, file *models.File) (string, *httperrors.Error)
+	GetVersions(ctx fiber.Ctx, id *uuid.UUID) ([]models.FileVersion, *httperrors.Error)
+	GetVersionDownloadURL(ctx fiber.Ctx, id, versionId *uuid.UUID, disposition string) (*models.DownloadSignedURLResponse, *httperrors.Error)
+	RestoreVersion(ctx fiber.Ctx, id, versionId *uuid.UUID) (*models.File, *httperrors.Error)
+	DeleteVersion(ctx fiber.Ctx, id, versionId *uuid.UUID) (*models.FileVersion, *httperrors.Error)
 }
 
 type Folder interface {
-	Create(ctx fiber.Ctx, folder *models.Folder) (*models.Folder, *httperrors.Error)
-	GetALL(ctx fiber.Ctx) ([]models.Folder, *httperrors.Error)
+	Create(ctx fiber.Ctx, folder *models.Folder, onConflict string) (*models.Folder, bool, *httperrors.Error)
+	GetALL(ctx fiber.Ctx, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error)
 	GetById(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error)
-	GetSubFolders(ctx fiber.Ctx, id *uuid.UUID) ([]models.Folder, *httperrors.Error)
+	GetSubFolders(ctx fiber.Ctx, id *uuid.UUID, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error)
+	GetChildren(ctx fiber.Ctx, id *uuid.UUID, includePending bool, opts *models.ListOptions) ([]models.Child, *models.Page, *httperrors.Error)
+	GetTree(ctx fiber.Ctx, id *uuid.UUID, depth int, includeFiles bool) (*models.Tree, *httperrors.Error)
+	Resolve(ctx fiber.Ctx, path string) (*models.Resolved, *httperrors.Error)
+	GetBreadcrumbs(ctx fiber.Ctx, id *uuid.UUID) ([]models.Breadcrumb, *httperrors.Error)
+	Delete(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error)
+	Restore(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error)
+	Update(ctx fiber.Ctx, id *uuid.UUID, patch *models.FolderPatch) (*models.Folder, *httperrors.Error)
+}
+
+type UploadSession interface {
+	Create(ctx fiber.Ctx, fileId uuid.UUID, req *models.CreateUploadSessionRequest) (*models.UploadSession, *httperrors.Error)
+	GetById(ctx fiber.Ctx, id uuid.UUID) (*models.UploadSession, *httperrors.Error)
+	GetPartURL(ctx fiber.Ctx, id uuid.UUID, partNumber int) (*models.UploadSignedURLResponse, *httperrors.Error)
+	CompletePart(ctx fiber.Ctx, id uuid.UUID, part *models.UploadPart) (*models.UploadSession, *httperrors.Error)
+	Complete(ctx fiber.Ctx, id uuid.UUID) (*models.File, *httperrors.Error)
+	Abort(ctx fiber.Ctx, id uuid.UUID) (*models.UploadSession, *httperrors.Error)
+}
+
+type TusUpload interface {
+	Create(ctx fiber.Ctx, length int64, metadata string) (*models.TusUpload, *httperrors.Error)
+	GetById(ctx fiber.Ctx, id uuid.UUID) (*models.TusUpload, *httperrors.Error)
+	Write(ctx fiber.Ctx, id uuid.UUID, offset int64, body io.Reader, checksum string) (*models.TusUpload, *httperrors.Error)
+	Terminate(ctx fiber.Ctx, id uuid.UUID) *httperrors.Error
+}
+
+type Trash interface {
+	List(ctx fiber.Ctx) (*models.Trash, *httperrors.Error)
+	Restore(ctx fiber.Ctx, id uuid.UUID) (*models.TrashItem, *httperrors.Error)
+	Delete(ctx fiber.Ctx, id uuid.UUID) (*models.TrashItem, *httperrors.Error)
+}
+
+type Archive interface {
+	Create(ctx fiber.Ctx, folderId *uuid.UUID) (*models.ArchiveJob, *httperrors.Error)
+	GetById(ctx fiber.Ctx, id uuid.UUID) (*models.ArchiveJob, *httperrors.Error)
 }
 
 type Bucket interface {
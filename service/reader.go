@@ -0,0 +1,15 @@
+package service
+
+import "io"
+
+// CountingReader passes reads through to Reader and counts the bytes read.
+type CountingReader struct {
+	Reader io.Reader
+	Count  int64
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.Count += int64(n)
+	return n, err
+}
@@ -0,0 +1,142 @@
+package reaper
+
+import (
+	"context"
+	"fm/models"
+	"fm/service/tus"
+	"fm/store"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// reaper periodically removes files whose upload was never completed, together
+// with any partial object left in the bucket and the multipart and tus uploads
+// still staging parts for it. An overwrite that was never completed only loses
+// its pending version; the file keeps its content.
+type reaper struct {
+	fileStore    store.File
+	versionStore store.FileVersion
+	sessionStore store.UploadSession
+	tusStore     store.TusUpload
+	bucket       store.Bucket
+	ttl          time.Duration
+	interval     time.Duration
+	batchSize    int
+	reaped       atomic.Int64
+}
+
+func New(fileStore store.File, versionStore store.FileVersion, sessionStore store.UploadSession, tusStore store.TusUpload, bucket store.Bucket, ttl, interval time.Duration, batchSize int) *reaper {
+	return &reaper{
+		fileStore:    fileStore,
+		versionStore: versionStore,
+		sessionStore: sessionStore,
+		tusStore:     tusStore,
+		bucket:       bucket,
+		ttl:          ttl,
+		interval:     interval,
+		batchSize:    batchSize,
+	}
+}
+
+// Run reaps on every interval until ctx is cancelled. It blocks, so callers
+// start it in its own goroutine and wait for it to return on shutdown.
+func (r *reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("upload reaper stopped, total reaped:", r.reaped.Load())
+			return
+		case <-ticker.C:
+			count := r.reap(ctx)
+			if count > 0 {
+				log.Println("upload reaper removed", count, "abandoned uploads")
+			}
+		}
+	}
+}
+
+// reap works through stale uploads one batch at a time until none are left or
+// ctx is cancelled, returning how many were removed.
+func (r *reaper) reap(ctx context.Context) int {
+	var count int
+
+	for ctx.Err() == nil {
+		files, err := r.fileStore.GetStaleUploads(ctx, time.Now().UTC().Add(-r.ttl), r.batchSize)
+		if err != nil {
+			log.Println("upload reaper failed to list stale uploads:", err)
+			return count
+		}
+
+		var removed int
+		for _, file := range files {
+			deleted, err := r.reapFile(ctx, file)
+			if err != nil {
+				log.Println("upload reaper failed to remove file", file.Id, err)
+				continue
+			}
+			if deleted {
+				removed++
+			}
+		}
+
+		count += removed
+		r.reaped.Add(int64(removed))
+
+		// a short or fully failing batch means there is nothing more to do this round
+		if len(files) < r.batchSize || removed == 0 {
+			return count
+		}
+	}
+
+	return count
+}
+
+// reapFile discards the pending version of a file with a staged overwrite, and
+// removes a file that never completed an upload otherwise.
+func (r *reaper) reapFile(ctx context.Context, file *models.File) (bool, error) {
+	if file.PendingVersionId != nil {
+		return r.versionStore.DeletePending(ctx, *file.PendingVersionId, func(version *models.FileVersion) error {
+			return r.removeUpload(ctx, file, version.S3Key)
+		})
+	}
+
+	return r.fileStore.DeleteStaleUpload(ctx, file.Id, func(file *models.File) error {
+		key := file.S3Key
+		if key == "" {
+			key = file.FullPath
+		}
+		return r.removeUpload(ctx, file, key)
+	})
+}
+
+// removeUpload aborts the multipart and tus uploads of file to key, so their
+// staged parts don't outlive it, and deletes whatever part of the object made
+// it to the bucket.
+func (r *reaper) removeUpload(ctx context.Context, file *models.File, key string) error {
+	err := r.sessionStore.AbortByKey(ctx, file.Id, key, func(session *models.UploadSession) error {
+		if err := r.bucket.AbortMultipartUpload(session.S3Key, session.UploadId, session.Parts); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = r.tusStore.DeleteByKey(ctx, file.Id, key, func(upload *models.TusUpload) error {
+		if err := tus.Discard(r.bucket, upload); err != nil {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.bucket.DeleteObject(key); err != nil {
+		return err
+	}
+	return nil
+}
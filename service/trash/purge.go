@@ -0,0 +1,208 @@
+package trash
+
+import (
+	"context"
+	"fm/models"
+	"fm/store"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// purger permanently removes trashed folders and files together with their
+// bucket objects: folder markers, file objects and file versions. Besides
+// serving DELETE /trash/:id it runs as a background job that empties the
+// trash of everything older than the retention.
+type purger struct {
+	folderStore  store.Folder
+	fileStore    store.File
+	versionStore store.FileVersion
+	bucket       store.Bucket
+	retention    time.Duration
+	interval     time.Duration
+	batchSize    int
+	purged       atomic.Int64
+}
+
+func NewPurger(folderStore store.Folder, fileStore store.File, versionStore store.FileVersion, bucket store.Bucket, retention, interval time.Duration, batchSize int) *purger {
+	return &purger{
+		folderStore:  folderStore,
+		fileStore:    fileStore,
+		versionStore: versionStore,
+		bucket:       bucket,
+		retention:    retention,
+		interval:     interval,
+		batchSize:    batchSize,
+	}
+}
+
+// Run purges expired trash on every interval until ctx is cancelled. It
+// blocks, so callers start it in its own goroutine and wait for it to return
+// on shutdown.
+func (p *purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("trash purger stopped, total purged:", p.purged.Load())
+			return
+		case <-ticker.C:
+			count := p.purgeExpired(ctx)
+			if count > 0 {
+				log.Println("trash purger removed", count, "expired trash entries")
+			}
+		}
+	}
+}
+
+// purgeExpired works through expired folders, then expired files, one batch
+// at a time until none are left or ctx is cancelled, returning how many were
+// removed.
+func (p *purger) purgeExpired(ctx context.Context) int {
+	var count int
+
+	for ctx.Err() == nil {
+		cutoff := time.Now().UTC().Add(-p.retention)
+
+		folders, err := p.folderStore.GetExpiredTrash(ctx, cutoff, p.batchSize)
+		if err != nil {
+			log.Println("trash purger failed to list expired folders:", err)
+			return count
+		}
+		files, err := p.fileStore.GetExpiredTrash(ctx, cutoff, p.batchSize)
+		if err != nil {
+			log.Println("trash purger failed to list expired files:", err)
+			return count
+		}
+
+		var removed int
+		for _, folder := range folders {
+			deleted, err := p.purgeFolder(ctx, folder.ID)
+			if err != nil {
+				log.Println("trash purger failed to remove folder", folder.ID, err)
+				continue
+			}
+			if deleted {
+				removed++
+			}
+		}
+		for _, file := range files {
+			deleted, err := p.purgeFile(ctx, file.Id)
+			if err != nil {
+				log.Println("trash purger failed to remove file", file.Id, err)
+				continue
+			}
+			if deleted {
+				removed++
+			}
+		}
+
+		count += removed
+		p.purged.Add(int64(removed))
+
+		// short or fully failing batches mean there is nothing more to do this round
+		if (len(folders) < p.batchSize && len(files) < p.batchSize) || removed == 0 {
+			return count
+		}
+	}
+
+	return count
+}
+
+// purgeFolder removes a trashed folder with its whole subtree: the objects of
+// its files, everything stored below their version prefixes, and everything
+// below the trash path of the folder and of every folder below it that was
+// trashed on its own before. The objects go first; if one can't be removed
+// the rows stay, and since missing objects are not an error, the purge can
+// simply be retried. It reports false when the folder is not in the trash.
+func (p *purger) purgeFolder(ctx context.Context, id uuid.UUID) (bool, error) {
+	return p.folderStore.PurgeTree(ctx, id, func(trashPaths []string, folders []models.Folder, files []*models.File) error {
+		for _, file := range files {
+			if err := p.removeFileObjects(ctx, file); err != nil {
+				return err
+			}
+		}
+
+		for _, trashPath := range trashPaths {
+			if err := p.sweep(trashPath); err != nil {
+				return err
+			}
+		}
+
+		// folders trashed before their objects were moved to a trash path
+		// still have their markers under paths that may be in use again, so
+		// only those are removed
+		if len(trashPaths) > 0 {
+			return nil
+		}
+		for _, folder := range folders {
+			if err := p.bucket.DeleteFolder(folder.FullPath); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// purgeFile removes a trashed file with its object and versions. It reports
+// false when the file is not in the trash.
+func (p *purger) purgeFile(ctx context.Context, id uuid.UUID) (bool, error) {
+	return p.fileStore.Purge(ctx, id, func(file *models.File) error {
+		return p.removeFileObjects(ctx, file)
+	})
+}
+
+// removeFileObjects deletes the object of a file, the objects of its versions
+// and whatever else is stored below its version prefix, such as staged parts
+// of uploads.
+func (p *purger) removeFileObjects(ctx context.Context, file *models.File) error {
+	versionKeys, err := p.versionStore.GetKeysByFileIds(ctx, []uuid.UUID{file.Id})
+	if err != nil {
+		return err
+	}
+	if err := p.deleteObjects(append(versionKeys, objectKey(file))); err != nil {
+		return err
+	}
+	return p.sweep(versionsPath(file.Id))
+}
+
+// versionsPath is the path below which the content of file id is stored.
+func versionsPath(id uuid.UUID) string {
+	return "/.versions/" + id.String()
+}
+
+// sweep deletes every object stored below fullPath.
+func (p *purger) sweep(fullPath string) error {
+	objects, err := p.bucket.ListObjects(p.bucket.ObjectKey(fullPath))
+	if err != nil {
+		return err
+	}
+	for _, object := range objects {
+		if err := p.bucket.DeleteObject(object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *purger) deleteObjects(keys []string) error {
+	for _, key := range keys {
+		if err := p.bucket.DeleteObject(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// objectKey returns the key of a file's object; rows created before s3_key was
+// populated only carry it in full_path.
+func objectKey(file *models.File) string {
+	if file.S3Key == "" {
+		return file.FullPath
+	}
+	return file.S3Key
+}
@@ -0,0 +1,90 @@
+package trash
+
+import (
+	"fm/models"
+	"fm/service"
+	"fm/store"
+	"log"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+type trashService struct {
+	folderStore store.Folder
+	fileStore   store.File
+	folderSvc   service.Folder
+	fileSvc     service.File
+	purger      *purger
+}
+
+func New(folderStore store.Folder, fileStore store.File, versionStore store.FileVersion, folderSvc service.Folder, fileSvc service.File, bucket store.Bucket) *trashService {
+	return &trashService{
+		folderStore: folderStore,
+		fileStore:   fileStore,
+		folderSvc:   folderSvc,
+		fileSvc:     fileSvc,
+		// only used for single purges, so retention and schedule don't matter
+		purger: NewPurger(folderStore, fileStore, versionStore, bucket, 0, 0, 0),
+	}
+}
+
+// List returns the folders and files that were moved to the trash.
+func (s *trashService) List(ctx fiber.Ctx) (*models.Trash, *httperrors.Error) {
+	folders, err := s.folderStore.GetTrash(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.fileStore.GetTrash(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Trash{Folders: folders, Files: files}, nil
+}
+
+// Restore takes the folder or file with the given id out of the trash.
+func (s *trashService) Restore(ctx fiber.Ctx, id uuid.UUID) (*models.TrashItem, *httperrors.Error) {
+	folder, err := s.folderSvc.Restore(ctx, &id)
+	if err == nil {
+		return &models.TrashItem{Type: models.ChildFolder, Folder: folder}, nil
+	}
+	if err.Code != codes.NotFound {
+		return nil, err
+	}
+
+	file, err := s.fileSvc.Restore(ctx, &id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TrashItem{Type: models.ChildFile, File: file}, nil
+}
+
+// Delete permanently removes the trashed folder or file with the given id,
+// including its bucket objects.
+func (s *trashService) Delete(ctx fiber.Ctx, id uuid.UUID) (*models.TrashItem, *httperrors.Error) {
+	folder, err := s.folderStore.GetTrashedById(ctx, &id)
+	if err == nil {
+		if _, purgeErr := s.purger.purgeFolder(ctx.Context(), id); purgeErr != nil {
+			log.Println("failed to purge folder", id, purgeErr)
+			return nil, httperrors.New(codes.InternalServerError, "Failed to delete folder")
+		}
+		return &models.TrashItem{Type: models.ChildFolder, Folder: folder}, nil
+	}
+	if err.Code != codes.NotFound {
+		return nil, err
+	}
+
+	file, err := s.fileStore.GetTrashedById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, purgeErr := s.purger.purgeFile(ctx.Context(), id); purgeErr != nil {
+		log.Println("failed to purge file", id, purgeErr)
+		return nil, httperrors.New(codes.InternalServerError, "Failed to delete file")
+	}
+	return &models.TrashItem{Type: models.ChildFile, File: file}, nil
+}
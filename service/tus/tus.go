@@ -0,0 +1,406 @@
+package tus
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fm/models"
+	"fm/service"
+	"fm/store"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// ChecksumAlgorithms lists the Upload-Checksum algorithms Write accepts.
+var ChecksumAlgorithms = []string{"sha1", "md5", "sha256"}
+
+type tusService struct {
+	tusStore  store.TusUpload
+	fileStore store.File
+	fileSvc   service.File
+	bucket    store.Bucket
+}
+
+func New(tusStore store.TusUpload, fileStore store.File, fileSvc service.File, bucket store.Bucket) *tusService {
+	return &tusService{tusStore: tusStore, fileStore: fileStore, fileSvc: fileSvc, bucket: bucket}
+}
+
+// Create registers a new upload of length bytes. The files row is created
+// through the regular file flow, so it starts out pending like a presigned upload.
+func (s *tusService) Create(ctx fiber.Ctx, length int64, metadata string) (*models.TusUpload, *httperrors.Error) {
+	values := parseMetadata(metadata)
+
+	name := values["filename"]
+	if name == "" {
+		name = values["name"]
+	}
+	if name == "" {
+		return nil, httperrors.HeaderValidationError(httperrors.MissingHeader("Upload-Metadata filename"))
+	}
+
+	file := models.File{
+		Name:     name,
+		Size:     int(length),
+		MimeType: values["filetype"],
+	}
+	if folderId, ok := values["folder_id"]; ok {
+		id, err := uuid.Parse(folderId)
+		if err != nil {
+			return nil, httperrors.HeaderValidationError(httperrors.InvalidHeader("Upload-Metadata folder_id"))
+		}
+		file.FolderId = id
+	}
+	if uploadedBy, ok := values["uploaded_by"]; ok {
+		id, err := uuid.Parse(uploadedBy)
+		if err != nil {
+			return nil, httperrors.HeaderValidationError(httperrors.InvalidHeader("Upload-Metadata uploaded_by"))
+		}
+		file.UploadedBy = id
+	}
+
+	created, err := s.fileSvc.Create(ctx, &file, models.ConflictFail)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadId, err := s.bucket.CreateMultipartUpload(created.S3Key)
+	if err != nil {
+		return nil, err
+	}
+
+	upload, err := s.tusStore.Create(ctx, &models.TusUpload{
+		FileId:   created.Id,
+		UploadId: uploadId,
+		S3Key:    created.S3Key,
+		Length:   length,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// an empty upload is complete as soon as it exists
+	if length == 0 {
+		if err := s.finish(ctx, upload); err != nil {
+			return nil, err
+		}
+	}
+
+	return upload, nil
+}
+
+func (s *tusService) GetById(ctx fiber.Ctx, id uuid.UUID) (*models.TusUpload, *httperrors.Error) {
+	return s.tusStore.GetById(ctx, id)
+}
+
+// partSize is the size of every staged part but the last. Chunks are merged
+// and split to it, since S3 rejects smaller parts before the last one.
+const partSize = 5 << 20
+
+// Write appends body at offset. The bytes are staged in the bucket as parts of
+// partSize, and whatever doesn't fill a part yet as the upload's tail; a body
+// that breaks off half way keeps what was received. With a checksum the chunk
+// is verified before anything is staged, so it counts as a whole or not at
+// all. The upload's row stays locked while the chunk is staged, so a second
+// PATCH to the same upload fails on every instance rather than overwriting
+// its parts. Reaching the declared length assembles the object and marks the
+// file uploaded.
+func (s *tusService) Write(ctx fiber.Ctx, id uuid.UUID, offset int64, body io.Reader, checksum string) (*models.TusUpload, *httperrors.Error) {
+	wrote := false
+	var staleTail string
+	upload, err := s.tusStore.Write(ctx, id, func(upload *models.TusUpload) *httperrors.Error {
+		if offset != upload.Offset {
+			return httperrors.New(codes.Conflict, "Upload-Offset does not match the current offset")
+		}
+		if upload.Offset == upload.Length {
+			return nil
+		}
+
+		reader := io.LimitReader(body, upload.Length-upload.Offset)
+		if checksum != "" {
+			spool, err := verify(reader, checksum)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				spool.Close()
+				os.Remove(spool.Name())
+			}()
+			reader = spool
+		}
+
+		previous := *upload
+		if err := s.stage(upload, reader); err != nil {
+			return err
+		}
+		wrote = upload.Offset != previous.Offset
+		if previous.TailSize > 0 && wrote {
+			staleTail = tailKey(&previous)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the tail the saved state no longer points at
+	if staleTail != "" {
+		if err := s.bucket.DeleteObject(staleTail); err != nil {
+			log.Println("failed to remove stale tus tail", staleTail, err)
+		}
+	}
+
+	if wrote && upload.Offset == upload.Length {
+		if err := s.finish(ctx, upload); err != nil {
+			return nil, err
+		}
+	}
+
+	return upload, nil
+}
+
+// verify spools body to a temporary file while hashing it and checks the
+// digest against the Upload-Checksum header. The returned file is positioned
+// at its start; the caller closes and removes it.
+func verify(body io.Reader, checksum string) (*os.File, *httperrors.Error) {
+	digest, expected, err := parseChecksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	spool, spoolErr := os.CreateTemp("", "tus-chunk-*")
+	if spoolErr != nil {
+		return nil, httperrors.NewServerError()
+	}
+	discard := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+
+	// a chunk that broke off can't be verified, so none of it is kept
+	if _, copyErr := io.Copy(spool, io.TeeReader(body, digest)); copyErr != nil {
+		discard()
+		return nil, httperrors.New(codes.BadRequest, "Upload body could not be read")
+	}
+	if !bytes.Equal(digest.Sum(nil), expected) {
+		discard()
+		return nil, httperrors.New(models.TusChecksumMismatch, "Upload-Checksum does not match the received data")
+	}
+	if _, seekErr := spool.Seek(0, io.SeekStart); seekErr != nil {
+		discard()
+		return nil, httperrors.NewServerError()
+	}
+	return spool, nil
+}
+
+// stage appends body to the staged bytes of upload: the tail is topped up
+// from body, and every time it fills a part, the part is uploaded. Whatever
+// remains when body ends, for whatever reason, becomes the new tail, or the
+// last part when it completes the upload. upload is updated to match; the
+// caller saves it.
+func (s *tusService) stage(upload *models.TusUpload, body io.Reader) *httperrors.Error {
+	buffer := make([]byte, partSize)
+	filled := 0
+	if upload.TailSize > 0 {
+		tail, err := s.bucket.GetObject(tailKey(upload), 0, upload.TailSize)
+		if err != nil {
+			return err
+		}
+		n, readErr := io.ReadFull(tail, buffer[:upload.TailSize])
+		tail.Close()
+		if readErr != nil {
+			return httperrors.New(codes.InternalServerError, "Staged upload data could not be read")
+		}
+		filled = n
+	}
+
+	received := false
+	for {
+		n, readErr := io.ReadFull(body, buffer[filled:])
+		filled += n
+		received = received || n > 0
+		if filled < partSize {
+			if readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+				log.Println("tus upload body broke off", upload.Id, readErr)
+			}
+			break
+		}
+
+		if err := s.savePart(upload, buffer); err != nil {
+			return err
+		}
+		filled = 0
+	}
+
+	if !received || filled == 0 {
+		return nil
+	}
+
+	if upload.Offset-upload.TailSize+int64(filled) == upload.Length {
+		return s.savePart(upload, buffer[:filled])
+	}
+
+	// every tail gets a key of its own, so the one the saved state points at
+	// stays intact until the new state is saved
+	upload.Offset += int64(filled) - upload.TailSize
+	upload.TailSize = int64(filled)
+	return s.bucket.PutObject(tailKey(upload), bytes.NewReader(buffer[:filled]), "application/octet-stream")
+}
+
+// savePart uploads data, which starts where the tail does, as the next part
+// and moves the offset past it.
+func (s *tusService) savePart(upload *models.TusUpload, data []byte) *httperrors.Error {
+	partNumber := upload.PartCount + 1
+	if err := s.bucket.UploadPart(upload.S3Key, upload.UploadId, partNumber, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	upload.Offset += int64(len(data)) - upload.TailSize
+	upload.PartCount = partNumber
+	upload.TailSize = 0
+	return nil
+}
+
+// Terminate stops the upload and removes its staged data. The file it was
+// creating never got uploaded, so its row is deleted outright, and the
+// tus_uploads row cascades with it; a file the upload already completed stays.
+func (s *tusService) Terminate(ctx fiber.Ctx, id uuid.UUID) *httperrors.Error {
+	upload, err := s.tusStore.GetById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	deleted, deleteErr := s.fileStore.DeleteStaleUpload(ctx.Context(), upload.FileId, func(*models.File) error {
+		if err := Discard(s.bucket, upload); err != nil {
+			return err
+		}
+		return nil
+	})
+	if deleteErr != nil {
+		return httperrors.New(codes.InternalServerError, deleteErr.Error())
+	}
+	if deleted {
+		return nil
+	}
+
+	return s.tusStore.Delete(ctx, id)
+}
+
+// Discard removes what an unfinished upload staged in the bucket: its
+// multipart upload and every tail it wrote, including any a failed PATCH
+// left behind.
+func Discard(bucket store.Bucket, upload *models.TusUpload) *httperrors.Error {
+	if err := bucket.AbortMultipartUpload(upload.S3Key, upload.UploadId, stagedParts(upload)); err != nil {
+		return err
+	}
+	tails, err := bucket.ListObjects(tailPrefix(upload))
+	if err != nil {
+		return err
+	}
+	for _, tail := range tails {
+		if err := bucket.DeleteObject(tail.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish assembles the staged parts into the file's object. An empty upload
+// has no parts, which a multipart upload can't be completed with, so its
+// object is written directly.
+func (s *tusService) finish(ctx fiber.Ctx, upload *models.TusUpload) *httperrors.Error {
+	if upload.Length == 0 {
+		if err := s.bucket.AbortMultipartUpload(upload.S3Key, upload.UploadId, nil); err != nil {
+			return err
+		}
+		if err := s.bucket.PutObject(upload.S3Key, bytes.NewReader(nil), ""); err != nil {
+			return err
+		}
+	} else if err := s.bucket.CompleteMultipartUpload(upload.S3Key, upload.UploadId, stagedParts(upload)); err != nil {
+		return err
+	}
+
+	file, err := s.fileStore.GetById(ctx, upload.FileId)
+	if err != nil {
+		return err
+	}
+
+	file.Status = models.FileStatusUploaded
+	file.Size = int(upload.Length)
+	return s.fileSvc.CommitUpload(ctx, file)
+}
+
+// tailKey is where the bytes of upload that don't fill a part yet are kept.
+// The key includes the offset the tail ends at, which only ever grows.
+func tailKey(upload *models.TusUpload) string {
+	return fmt.Sprintf("%s/%d", tailPrefix(upload), upload.Offset)
+}
+
+// tailPrefix is the prefix of every tail key of upload.
+func tailPrefix(upload *models.TusUpload) string {
+	return fmt.Sprintf("%s.tail/%s", upload.S3Key, upload.UploadId)
+}
+
+func stagedParts(upload *models.TusUpload) []models.UploadPart {
+	parts := make([]models.UploadPart, 0, upload.PartCount)
+	for number := 1; number <= upload.PartCount; number++ {
+		parts = append(parts, models.UploadPart{PartNumber: number})
+	}
+	return parts
+}
+
+// parseMetadata decodes an Upload-Metadata header: comma separated pairs of a
+// key and an optional base64 encoded value.
+func parseMetadata(header string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+		var value string
+		if len(fields) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		values[fields[0]] = value
+	}
+	return values
+}
+
+// parseChecksum reads an Upload-Checksum header of the form "<algorithm> <base64 digest>".
+func parseChecksum(header string) (hash.Hash, []byte, *httperrors.Error) {
+	fields := strings.Fields(header)
+	if len(fields) != 2 {
+		return nil, nil, httperrors.HeaderValidationError(httperrors.InvalidHeader("Upload-Checksum"))
+	}
+
+	expected, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, nil, httperrors.HeaderValidationError(httperrors.InvalidHeader("Upload-Checksum"))
+	}
+
+	switch fields[0] {
+	case "sha1":
+		return sha1.New(), expected, nil
+	case "md5":
+		return md5.New(), expected, nil
+	case "sha256":
+		return sha256.New(), expected, nil
+	}
+	return nil, nil, httperrors.HeaderValidationError(httperrors.InvalidHeader("Upload-Checksum"))
+}
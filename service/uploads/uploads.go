@@ -0,0 +1,213 @@
+package uploads
+
+import (
+	"fm/models"
+	svc "fm/service"
+	"fm/store"
+	"fmt"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+const (
+	minPartSize     = 5 << 20
+	defaultPartSize = 16 << 20
+	maxPartCount    = 10000
+)
+
+type service struct {
+	sessionStore store.UploadSession
+	fileStore    store.File
+	fileSvc      svc.File
+	bucket       store.Bucket
+}
+
+func New(sessionStore store.UploadSession, fileStore store.File, fileSvc svc.File, bucket store.Bucket) *service {
+	return &service{sessionStore: sessionStore, fileStore: fileStore, fileSvc: fileSvc, bucket: bucket}
+}
+
+// Create starts a multipart upload for a file created through POST /file that
+// has not been uploaded yet, or for an overwrite staged on it.
+func (s *service) Create(ctx fiber.Ctx, fileId uuid.UUID, req *models.CreateUploadSessionRequest) (*models.UploadSession, *httperrors.Error) {
+	if req.TotalSize <= 0 {
+		return nil, httperrors.RequestValidationError(httperrors.InvalidParameter("total_size"))
+	}
+	if req.PartSize == 0 {
+		req.PartSize = defaultPartSize
+	}
+	if req.PartSize < minPartSize {
+		return nil, httperrors.RequestValidationError(httperrors.InvalidParameter("part_size"))
+	}
+
+	// too small a part size for a big file would exceed the part limit
+	partCount := int((req.TotalSize + req.PartSize - 1) / req.PartSize)
+	if partCount > maxPartCount {
+		return nil, httperrors.RequestValidationError(httperrors.InvalidParameter("part_size"))
+	}
+
+	file, err := s.fileStore.GetById(ctx, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if file.Status == models.FileStatusUploaded && file.PendingVersionId == nil {
+		return nil, httperrors.New(codes.Conflict, "File has already been uploaded")
+	}
+
+	key, err := s.fileSvc.UploadKey(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadId, err := s.bucket.CreateMultipartUpload(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.sessionStore.Create(ctx, &models.UploadSession{
+		FileId:    file.Id,
+		UploadId:  uploadId,
+		S3Key:     key,
+		TotalSize: req.TotalSize,
+		PartSize:  req.PartSize,
+		PartCount: partCount,
+		Status:    models.UploadSessionActive,
+	})
+}
+
+// GetById returns the session with the parts already completed, which is what
+// a client needs to resume an interrupted upload.
+func (s *service) GetById(ctx fiber.Ctx, id uuid.UUID) (*models.UploadSession, *httperrors.Error) {
+	return s.sessionStore.GetById(ctx, id)
+}
+
+func (s *service) GetPartURL(ctx fiber.Ctx, id uuid.UUID, partNumber int) (*models.UploadSignedURLResponse, *httperrors.Error) {
+	session, err := s.activeSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if partNumber < 1 || partNumber > session.PartCount {
+		return nil, httperrors.RequestValidationError(httperrors.OutOfRange("part_number", 1, session.PartCount))
+	}
+
+	return s.bucket.GeneratePresignedPartURL(session.S3Key, session.UploadId, partNumber)
+}
+
+func (s *service) CompletePart(ctx fiber.Ctx, id uuid.UUID, part *models.UploadPart) (*models.UploadSession, *httperrors.Error) {
+	session, err := s.activeSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if part.PartNumber < 1 || part.PartNumber > session.PartCount {
+		return nil, httperrors.RequestValidationError(httperrors.OutOfRange("part_number", 1, session.PartCount))
+	}
+	if part.ETag == "" {
+		return nil, httperrors.RequestValidationError(httperrors.MissingParameter("etag"))
+	}
+	if part.Size != s.expectedPartSize(session, part.PartNumber) {
+		return nil, httperrors.RequestValidationError(httperrors.InvalidParameter("size"))
+	}
+
+	if err := s.sessionStore.SavePart(ctx, session.Id, part); err != nil {
+		return nil, err
+	}
+
+	return s.sessionStore.GetById(ctx, id)
+}
+
+// Complete assembles the parts into the file's object and marks the file as
+// uploaded. Every part has to be reported before the upload can complete.
+func (s *service) Complete(ctx fiber.Ctx, id uuid.UUID) (*models.File, *httperrors.Error) {
+	session, err := s.activeSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(session.Parts) != session.PartCount {
+		missing := httperrors.RequestValidationError()
+		for number, part := 1, 0; number <= session.PartCount; number++ {
+			if part < len(session.Parts) && session.Parts[part].PartNumber == number {
+				part++
+				continue
+			}
+			missing.AddDetail(httperrors.MissingParameter(fmt.Sprintf("part %d", number)))
+		}
+		return nil, missing
+	}
+
+	file, err := s.fileStore.GetById(ctx, session.FileId)
+	if err != nil {
+		return nil, err
+	}
+
+	// an overwrite staged after the session started owns the file's upload now
+	key, err := s.fileSvc.UploadKey(ctx, file)
+	if err != nil {
+		return nil, err
+	}
+	if key != session.S3Key {
+		return nil, httperrors.New(codes.Conflict, "Upload session was superseded by another upload")
+	}
+
+	if err := s.bucket.CompleteMultipartUpload(session.S3Key, session.UploadId, session.Parts); err != nil {
+		return nil, err
+	}
+
+	file.Status = models.FileStatusUploaded
+	file.S3Key = session.S3Key
+	file.Size = int(session.TotalSize)
+	if info, err := s.bucket.GetObjectInfo(session.S3Key); err == nil && info.ContentType != "" {
+		file.MimeType = info.ContentType
+	}
+
+	if err := s.fileSvc.CommitUpload(ctx, file); err != nil {
+		return nil, err
+	}
+
+	session.Status = models.UploadSessionCompleted
+	if err := s.sessionStore.UpdateStatus(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (s *service) Abort(ctx fiber.Ctx, id uuid.UUID) (*models.UploadSession, *httperrors.Error) {
+	session, err := s.activeSession(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.bucket.AbortMultipartUpload(session.S3Key, session.UploadId, session.Parts); err != nil {
+		return nil, err
+	}
+
+	session.Status = models.UploadSessionAborted
+	if err := s.sessionStore.UpdateStatus(ctx, session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *service) activeSession(ctx fiber.Ctx, id uuid.UUID) (*models.UploadSession, *httperrors.Error) {
+	session, err := s.sessionStore.GetById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != models.UploadSessionActive {
+		return nil, httperrors.New(codes.Conflict, "Upload session is "+session.Status)
+	}
+	return session, nil
+}
+
+// expectedPartSize is the part size for every part but the last, which holds
+// whatever remains of the file.
+func (s *service) expectedPartSize(session *models.UploadSession, partNumber int) int64 {
+	if partNumber < session.PartCount {
+		return session.PartSize
+	}
+	return session.TotalSize - int64(session.PartCount-1)*session.PartSize
+}
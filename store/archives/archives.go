@@ -0,0 +1,229 @@
+package archives
+
+import (
+	"context"
+	"database/sql"
+	"fm/models"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+type store struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *store {
+	return &store{db: db}
+}
+
+const jobColumns = `id, folder_id, status, s3_key, file_name, files_total, files_done, bytes_total, bytes_done, error, attempts, created_at, updated_at, finished_at`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanJob reads a row selected with jobColumns.
+func scanJob(row scanner) (*models.ArchiveJob, error) {
+	var job models.ArchiveJob
+	err := row.Scan(
+		&job.Id,
+		&job.FolderId,
+		&job.Status,
+		&job.S3Key,
+		&job.FileName,
+		&job.FilesTotal,
+		&job.FilesDone,
+		&job.BytesTotal,
+		&job.BytesDone,
+		&job.Error,
+		&job.Attempts,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (s *store) Create(ctx fiber.Ctx, job *models.ArchiveJob) (*models.ArchiveJob, *httperrors.Error) {
+	query := `INSERT INTO archive_jobs (id, folder_id, status, s3_key, file_name, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	now := time.Now().UTC()
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	if job.Id == uuid.Nil {
+		job.Id = uuid.New()
+	}
+	if job.Status == "" {
+		job.Status = models.ArchiveJobPending
+	}
+
+	_, err := s.db.ExecContext(ctx.Context(), query,
+		job.Id,
+		job.FolderId,
+		job.Status,
+		job.S3Key,
+		job.FileName,
+		job.CreatedAt,
+		job.UpdatedAt,
+	)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return job, nil
+}
+
+func (s *store) GetById(ctx fiber.Ctx, id uuid.UUID) (*models.ArchiveJob, *httperrors.Error) {
+	query := `SELECT ` + jobColumns + ` FROM archive_jobs WHERE id = $1`
+	job, err := scanJob(s.db.QueryRowContext(ctx.Context(), query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Job not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return job, nil
+}
+
+// Claim marks the oldest runnable job as running and returns it, or nil when
+// there is none. Besides pending jobs, running jobs that have not reported
+// progress since staleBefore are taken over: their worker is assumed gone.
+// Each claim starts the job over and counts as an attempt; the attempt number
+// identifies the claim in later updates.
+func (s *store) Claim(ctx context.Context, staleBefore time.Time) (*models.ArchiveJob, error) {
+	query := `UPDATE archive_jobs SET status = $1, attempts = attempts + 1, files_done = 0, bytes_done = 0, updated_at = $2
+	WHERE id = (
+		SELECT id FROM archive_jobs
+		WHERE status = $3 OR (status = $1 AND updated_at < $4)
+		ORDER BY created_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+	job, err := scanJob(s.db.QueryRowContext(ctx, query, models.ArchiveJobRunning, time.Now().UTC(), models.ArchiveJobPending, staleBefore))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+// SaveProgress records the job's counters. It reports false when the claim
+// has been lost to another worker, which should then stop working on it.
+func (s *store) SaveProgress(ctx context.Context, job *models.ArchiveJob) (bool, error) {
+	job.UpdatedAt = time.Now().UTC()
+	query := `UPDATE archive_jobs SET files_total = $1, files_done = $2, bytes_total = $3, bytes_done = $4, updated_at = $5
+	WHERE id = $6 AND status = $7 AND attempts = $8`
+	return s.update(ctx, query,
+		job.FilesTotal,
+		job.FilesDone,
+		job.BytesTotal,
+		job.BytesDone,
+		job.UpdatedAt,
+		job.Id,
+		models.ArchiveJobRunning,
+		job.Attempts,
+	)
+}
+
+// Finish records the final status, counters and error of the job. Like
+// SaveProgress it reports false when the claim has been lost.
+func (s *store) Finish(ctx context.Context, job *models.ArchiveJob) (bool, error) {
+	now := time.Now().UTC()
+	job.UpdatedAt = now
+	job.FinishedAt = &now
+	query := `UPDATE archive_jobs SET status = $1, files_total = $2, files_done = $3, bytes_total = $4, bytes_done = $5, error = $6, updated_at = $7, finished_at = $7
+	WHERE id = $8 AND status = $9 AND attempts = $10`
+	return s.update(ctx, query,
+		job.Status,
+		job.FilesTotal,
+		job.FilesDone,
+		job.BytesTotal,
+		job.BytesDone,
+		job.Error,
+		now,
+		job.Id,
+		models.ArchiveJobRunning,
+		job.Attempts,
+	)
+}
+
+// Release hands a job that was interrupted by shutdown back to the queue
+// without counting the attempt.
+func (s *store) Release(ctx context.Context, job *models.ArchiveJob) error {
+	query := `UPDATE archive_jobs SET status = $1, attempts = attempts - 1, files_done = 0, bytes_done = 0, updated_at = $2
+	WHERE id = $3 AND status = $4 AND attempts = $5`
+	_, err := s.update(ctx, query, models.ArchiveJobPending, time.Now().UTC(), job.Id, models.ArchiveJobRunning, job.Attempts)
+	return err
+}
+
+// update runs a statement guarded by a job's claim and reports whether it
+// matched.
+func (s *store) update(ctx context.Context, query string, args ...any) (bool, error) {
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+// DeleteExpired removes up to limit finished jobs that finished before
+// finishedBefore, calling removeObject with each of them before the rows go.
+// It returns how many were removed.
+func (s *store) DeleteExpired(ctx context.Context, finishedBefore time.Time, limit int, removeObject func(job *models.ArchiveJob) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM archive_jobs WHERE id IN (
+		SELECT id FROM archive_jobs
+		WHERE status IN ($1, $2) AND finished_at < $3
+		ORDER BY finished_at
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + jobColumns
+	rows, err := tx.QueryContext(ctx, query, models.ArchiveJobCompleted, models.ArchiveJobFailed, finishedBefore, limit)
+	if err != nil {
+		return 0, err
+	}
+	var jobs []*models.ArchiveJob
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, job := range jobs {
+		if err := removeObject(job); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(jobs), nil
+}
@@ -1,14 +1,18 @@
 package buckets
 
 import (
+	"bytes"
 	"encoding/json"
 	"fm/models"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	neturl "net/url"
+	"strings"
 	"time"
 
+	"github.com/syntaxLabz/errors/pkg/codes"
 	"github.com/syntaxLabz/errors/pkg/httperrors"
 )
 
@@ -17,6 +21,9 @@ type buckets struct {
 	bucketName   string
 	serviceToken string
 	client       *http.Client
+	// streamClient has no overall timeout, for transfers whose duration
+	// depends on the object size
+	streamClient *http.Client
 }
 
 func New(baseURL, bucketName, serviceToken string) *buckets {
@@ -27,6 +34,7 @@ func New(baseURL, bucketName, serviceToken string) *buckets {
 		client: &http.Client{
 			Timeout: 60 * time.Second,
 		},
+		streamClient: &http.Client{},
 	}
 }
 
@@ -60,7 +68,12 @@ func (b *buckets) CreateFolder(fullPath string) (*models.CreateObjectResponse, *
 }
 
 func (b *buckets) GeneratePresignedUploadURL(fullPath string) (*models.UploadSignedURLResponse, *httperrors.Error) {
-	url := fmt.Sprintf("%s/object/upload/sign/%s%s", b.baseURL, b.bucketName, fullPath)
+	return b.signUpload(b.ObjectKey(fullPath))
+}
+
+// signUpload issues a signed upload URL for the object stored under key.
+func (b *buckets) signUpload(key string) (*models.UploadSignedURLResponse, *httperrors.Error) {
+	url := fmt.Sprintf("%s/object/upload/sign/%s", b.baseURL, strings.TrimPrefix(key, "/"))
 
 	req, err := http.NewRequest(http.MethodPost, url, nil)
 	if err != nil {
@@ -68,6 +81,9 @@ func (b *buckets) GeneratePresignedUploadURL(fullPath string) (*models.UploadSig
 	}
 
 	req.Header.Set("Authorization", b.serviceToken)
+	// names are claimed in the database, so an upload to an existing key is
+	// an overwrite the caller asked for
+	req.Header.Set("x-upsert", "true")
 
 	resp, err := b.client.Do(req)
 	if err != nil {
@@ -87,7 +103,344 @@ func (b *buckets) GeneratePresignedUploadURL(fullPath string) (*models.UploadSig
 		return nil, httperrors.NewDBError()
 	}
 	presignedURLResponse.URL = b.baseURL + presignedURLResponse.URL
-	presignedURLResponse.S3Key = b.bucketName + fullPath
+	presignedURLResponse.S3Key = key
 	log.Print(presignedURLResponse)
 	return &presignedURLResponse, nil
 }
+
+// DeleteObject removes the object stored under key, where key is the S3Key
+// handed out by GeneratePresignedUploadURL (bucket name followed by the path).
+// An object that is already gone is not treated as an error.
+func (b *buckets) DeleteObject(key string) *httperrors.Error {
+	url := fmt.Sprintf("%s/object/%s", b.baseURL, strings.TrimPrefix(key, "/"))
+
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return httperrors.NewDBError()
+	}
+
+	req.Header.Set("Authorization", b.serviceToken)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return httperrors.NewDBError()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return httperrors.NewDBError()
+	}
+
+	return nil
+}
+
+// DeleteFolder removes the .keep marker written by CreateFolder for fullPath.
+func (b *buckets) DeleteFolder(fullPath string) *httperrors.Error {
+	return b.DeleteObject(b.ObjectKey(fullPath + "/.keep"))
+}
+
+// ObjectKey returns the S3Key under which the object at fullPath is stored.
+func (b *buckets) ObjectKey(fullPath string) string {
+	return b.bucketName + fullPath
+}
+
+// MoveObject moves the object stored under sourceKey to destinationKey. Both
+// keys are S3Keys as returned by ObjectKey. A missing source object is not
+// treated as an error since files may not have been uploaded yet.
+func (b *buckets) MoveObject(sourceKey, destinationKey string) *httperrors.Error {
+	url := fmt.Sprintf("%s/object/move", b.baseURL)
+
+	payload, err := json.Marshal(map[string]string{
+		"bucketId":       b.bucketName,
+		"sourceKey":      b.objectName(sourceKey),
+		"destinationKey": b.objectName(destinationKey),
+	})
+	if err != nil {
+		return httperrors.NewServerError()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return httperrors.NewDBError()
+	}
+
+	req.Header.Set("Authorization", b.serviceToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return httperrors.NewDBError()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return httperrors.NewDBError()
+	}
+
+	return nil
+}
+
+// MoveFolder moves every object stored below oldPath, the .keep markers
+// included, to the same place below newPath. The storage API has no prefix
+// move, so objects are moved one at a time; on error the ones moved so far
+// stay at newPath, and moving back from newPath to oldPath undoes the move.
+func (b *buckets) MoveFolder(oldPath, newPath string) *httperrors.Error {
+	oldPrefix := b.ObjectKey(oldPath)
+	objects, err := b.ListObjects(oldPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		if err := b.MoveObject(object.Key, b.ObjectKey(newPath)+strings.TrimPrefix(object.Key, oldPrefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GeneratePresignedDownloadURL signs a short-lived read URL for the object
+// stored under key. With an "attachment" disposition the storage API is asked
+// to serve the object as a download named after opts.FileName.
+func (b *buckets) GeneratePresignedDownloadURL(key string, opts models.DownloadOptions) (*models.DownloadSignedURLResponse, *httperrors.Error) {
+	url := fmt.Sprintf("%s/object/sign/%s", b.baseURL, strings.TrimPrefix(key, "/"))
+
+	payload, err := json.Marshal(map[string]int{"expiresIn": int(opts.ExpiresIn.Seconds())})
+	if err != nil {
+		return nil, httperrors.NewServerError()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, httperrors.NewDBError()
+	}
+
+	req.Header.Set("Authorization", b.serviceToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, httperrors.NewDBError()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, httperrors.New(codes.NotFound, "Object not found")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httperrors.NewDBError()
+	}
+
+	var signResponse struct {
+		SignedURL string `json:"signedURL"`
+	}
+	body, _ := io.ReadAll(resp.Body)
+
+	err = json.Unmarshal(body, &signResponse)
+	if err != nil {
+		return nil, httperrors.NewDBError()
+	}
+
+	downloadURL := b.baseURL + signResponse.SignedURL
+	if opts.Disposition == "attachment" {
+		downloadURL += "&download=" + neturl.QueryEscape(opts.FileName)
+	}
+
+	return &models.DownloadSignedURLResponse{
+		URL:         downloadURL,
+		ExpiresAt:   time.Now().UTC().Add(opts.ExpiresIn),
+		Disposition: opts.Disposition,
+		FileName:    opts.FileName,
+		MimeType:    opts.MimeType,
+	}, nil
+}
+
+// GetObjectInfo reads the metadata of the object stored under key.
+func (b *buckets) GetObjectInfo(key string) (*models.ObjectInfo, *httperrors.Error) {
+	url := fmt.Sprintf("%s/object/%s", b.baseURL, strings.TrimPrefix(key, "/"))
+
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		return nil, httperrors.NewDBError()
+	}
+
+	req.Header.Set("Authorization", b.serviceToken)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, httperrors.NewDBError()
+	}
+	defer resp.Body.Close()
+
+	// the storage API answers 400 instead of 404 for missing objects on some routes
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return nil, httperrors.New(codes.NotFound, "Object not found")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httperrors.NewDBError()
+	}
+
+	info := models.ObjectInfo{
+		Key:         key,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lastModified
+	}
+
+	return &info, nil
+}
+
+// CopyObject copies the object stored under sourceKey to destinationKey.
+func (b *buckets) CopyObject(sourceKey, destinationKey string) *httperrors.Error {
+	url := fmt.Sprintf("%s/object/copy", b.baseURL)
+
+	payload, err := json.Marshal(map[string]string{
+		"bucketId":       b.bucketName,
+		"sourceKey":      b.objectName(sourceKey),
+		"destinationKey": b.objectName(destinationKey),
+	})
+	if err != nil {
+		return httperrors.NewServerError()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return httperrors.NewDBError()
+	}
+
+	req.Header.Set("Authorization", b.serviceToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return httperrors.NewDBError()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return httperrors.New(codes.NotFound, "Object not found")
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return httperrors.NewDBError()
+	}
+
+	return nil
+}
+
+// ListObjects returns every object stored below prefix, an S3Key naming a
+// directory. The storage API lists one level at a time, so nested
+// directories are walked one request after another.
+func (b *buckets) ListObjects(prefix string) ([]models.ObjectInfo, *httperrors.Error) {
+	var objects []models.ObjectInfo
+
+	directories := []string{strings.Trim(b.objectName(prefix), "/")}
+	for len(directories) > 0 {
+		directory := directories[0]
+		directories = directories[1:]
+
+		for offset := 0; ; offset += listPageSize {
+			entries, err := b.listDirectory(directory, offset)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, entry := range entries {
+				name := entry.Name
+				if directory != "" {
+					name = directory + "/" + entry.Name
+				}
+				// entries without an id are directories
+				if entry.Id == nil {
+					directories = append(directories, name)
+					continue
+				}
+				objects = append(objects, models.ObjectInfo{
+					Key:          b.ObjectKey("/" + name),
+					Size:         entry.Metadata.Size,
+					ContentType:  entry.Metadata.MimeType,
+					ETag:         entry.Metadata.ETag,
+					LastModified: entry.UpdatedAt,
+				})
+			}
+
+			if len(entries) < listPageSize {
+				break
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+const listPageSize = 1000
+
+type listEntry struct {
+	Name      string    `json:"name"`
+	Id        *string   `json:"id"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Metadata  struct {
+		Size     int64  `json:"size"`
+		MimeType string `json:"mimetype"`
+		ETag     string `json:"eTag"`
+	} `json:"metadata"`
+}
+
+func (b *buckets) listDirectory(directory string, offset int) ([]listEntry, *httperrors.Error) {
+	url := fmt.Sprintf("%s/object/list/%s", b.baseURL, b.bucketName)
+
+	payload, err := json.Marshal(map[string]any{
+		"prefix": directory,
+		"limit":  listPageSize,
+		"offset": offset,
+	})
+	if err != nil {
+		return nil, httperrors.NewServerError()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, httperrors.NewDBError()
+	}
+
+	req.Header.Set("Authorization", b.serviceToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, httperrors.NewDBError()
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httperrors.NewDBError()
+	}
+
+	var entries []listEntry
+	body, _ := io.ReadAll(resp.Body)
+
+	err = json.Unmarshal(body, &entries)
+	if err != nil {
+		return nil, httperrors.NewDBError()
+	}
+	return entries, nil
+}
+
+// objectName strips the bucket name from key, leaving the path of the object
+// inside the bucket.
+func (b *buckets) objectName(key string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(key, b.bucketName), "/")
+}
@@ -0,0 +1,350 @@
+package fakestorage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fm/models"
+	"fm/store/buckets/memory"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// Server is a fake of the storage REST API spoken by buckets.New. It answers
+// the /object/... routes the REST driver uses, including signed upload and
+// download URLs, and keeps objects in memory. It is meant for tests and local
+// runs without a storage server:
+//
+//	server := fakestorage.New("token")
+//	defer server.Close()
+//	bucket := buckets.New(server.URL, "views", "token")
+type Server struct {
+	*httptest.Server
+
+	token   string
+	objects objectStore
+
+	mu sync.Mutex
+	// signed maps the tokens of signed URLs to the key they were issued for
+	signed map[string]string
+}
+
+// objectStore is the part of the memory bucket the server keeps objects in.
+type objectStore interface {
+	Objects() []string
+	PutObject(key string, body io.Reader, contentType string) *httperrors.Error
+	GetObject(key string, offset, length int64) (io.ReadCloser, *httperrors.Error)
+	GetObjectInfo(key string) (*models.ObjectInfo, *httperrors.Error)
+	DeleteObject(key string) *httperrors.Error
+	CopyObject(sourceKey, destinationKey string) *httperrors.Error
+	MoveObject(sourceKey, destinationKey string) *httperrors.Error
+	ListObjects(prefix string) ([]models.ObjectInfo, *httperrors.Error)
+}
+
+// New starts a fake storage server. Requests must carry token in their
+// Authorization header, except those to signed URLs; an empty token accepts
+// every request. Close shuts the server down.
+func New(token string) *Server {
+	s := &Server{
+		token:   token,
+		objects: memory.New(""),
+		signed:  make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /object/upload/sign/{key...}", s.authorized(s.signUpload))
+	mux.HandleFunc("PUT /object/upload/sign/{key...}", s.uploadSigned)
+	mux.HandleFunc("POST /object/sign/{key...}", s.authorized(s.signDownload))
+	mux.HandleFunc("GET /object/sign/{key...}", s.downloadSigned)
+	mux.HandleFunc("POST /object/move", s.authorized(s.move))
+	mux.HandleFunc("POST /object/copy", s.authorized(s.copy))
+	mux.HandleFunc("POST /object/list/{bucket}", s.authorized(s.list))
+	mux.HandleFunc("POST /object/{key...}", s.authorized(s.upload))
+	mux.HandleFunc("GET /object/{key...}", s.authorized(s.download))
+	mux.HandleFunc("DELETE /object/{key...}", s.authorized(s.delete))
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Objects returns the keys of every stored object, bucket name included, sorted.
+func (s *Server) Objects() []string {
+	return s.objects.Objects()
+}
+
+// Object returns the content of the object stored under key.
+func (s *Server) Object(key string) ([]byte, bool) {
+	body, err := s.objects.GetObject(key, 0, -1)
+	if err != nil {
+		return nil, false
+	}
+	defer body.Close()
+
+	data, readErr := io.ReadAll(body)
+	return data, readErr == nil
+}
+
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && r.Header.Get("Authorization") != s.token {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if r.Header.Get("x-upsert") != "true" {
+		if _, err := s.objects.GetObjectInfo(key); err == nil {
+			writeError(w, http.StatusConflict, "The resource already exists")
+			return
+		}
+	}
+
+	if err := s.objects.PutObject(key, r.Body, mediaType(r)); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, models.CreateObjectResponse{Key: key, Id: uuid.New()})
+}
+
+func (s *Server) download(w http.ResponseWriter, r *http.Request) {
+	s.serveObject(w, r, r.PathValue("key"))
+}
+
+func (s *Server) delete(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if _, err := s.objects.GetObjectInfo(key); err != nil {
+		writeError(w, http.StatusNotFound, "Object not found")
+		return
+	}
+
+	s.objects.DeleteObject(key)
+	writeJSON(w, map[string]string{"message": "Successfully deleted"})
+}
+
+func (s *Server) signUpload(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	token := s.issue(key)
+	writeJSON(w, map[string]string{
+		"url":   "/object/upload/sign/" + key + "?token=" + token,
+		"token": token,
+	})
+}
+
+func (s *Server) uploadSigned(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !s.redeem(r.URL.Query().Get("token"), key) {
+		writeError(w, http.StatusBadRequest, "invalid signature")
+		return
+	}
+
+	if err := s.objects.PutObject(key, r.Body, mediaType(r)); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, map[string]string{"Key": key})
+}
+
+func (s *Server) signDownload(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if _, err := s.objects.GetObjectInfo(key); err != nil {
+		writeError(w, http.StatusNotFound, "Object not found")
+		return
+	}
+
+	writeJSON(w, map[string]string{
+		"signedURL": "/object/sign/" + key + "?token=" + s.issue(key),
+	})
+}
+
+func (s *Server) downloadSigned(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if !s.redeem(r.URL.Query().Get("token"), key) {
+		writeError(w, http.StatusBadRequest, "invalid signature")
+		return
+	}
+
+	if name, ok := r.URL.Query()["download"]; ok {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name[0]}))
+	}
+	s.serveObject(w, r, key)
+}
+
+type transfer struct {
+	BucketId       string `json:"bucketId"`
+	SourceKey      string `json:"sourceKey"`
+	DestinationKey string `json:"destinationKey"`
+}
+
+func (s *Server) move(w http.ResponseWriter, r *http.Request) {
+	var body transfer
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	source := body.BucketId + "/" + body.SourceKey
+	if _, err := s.objects.GetObjectInfo(source); err != nil {
+		writeError(w, http.StatusNotFound, "Object not found")
+		return
+	}
+
+	s.objects.MoveObject(source, body.BucketId+"/"+body.DestinationKey)
+	writeJSON(w, map[string]string{"message": "Successfully moved"})
+}
+
+func (s *Server) copy(w http.ResponseWriter, r *http.Request) {
+	var body transfer
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	destination := body.BucketId + "/" + body.DestinationKey
+	if err := s.objects.CopyObject(body.BucketId+"/"+body.SourceKey, destination); err != nil {
+		writeError(w, http.StatusNotFound, "Object not found")
+		return
+	}
+	writeJSON(w, map[string]string{"Key": destination})
+}
+
+type listEntry struct {
+	Name      string        `json:"name"`
+	Id        *string       `json:"id"`
+	UpdatedAt string        `json:"updated_at,omitempty"`
+	Metadata  *listMetadata `json:"metadata"`
+}
+
+type listMetadata struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimetype"`
+	ETag     string `json:"eTag"`
+}
+
+// list answers with the objects and directories directly below prefix, like
+// the storage API does, paged by limit and offset.
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Prefix string `json:"prefix"`
+		Limit  int    `json:"limit"`
+		Offset int    `json:"offset"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	directory := r.PathValue("bucket")
+	if prefix := strings.Trim(body.Prefix, "/"); prefix != "" {
+		directory += "/" + prefix
+	}
+	objects, _ := s.objects.ListObjects(directory)
+
+	seen := make(map[string]bool)
+	var entries []listEntry
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, directory+"/")
+		if folder, _, nested := strings.Cut(name, "/"); nested {
+			if !seen[folder] {
+				seen[folder] = true
+				entries = append(entries, listEntry{Name: folder})
+			}
+			continue
+		}
+
+		id := uuid.NewString()
+		entries = append(entries, listEntry{
+			Name:      name,
+			Id:        &id,
+			UpdatedAt: object.LastModified.Format(time.RFC3339Nano),
+			Metadata:  &listMetadata{Size: object.Size, MimeType: object.ContentType, ETag: object.ETag},
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	if body.Offset > len(entries) {
+		body.Offset = len(entries)
+	}
+	entries = entries[body.Offset:]
+	if body.Limit > 0 && body.Limit < len(entries) {
+		entries = entries[:body.Limit]
+	}
+	if entries == nil {
+		entries = []listEntry{}
+	}
+	writeJSON(w, entries)
+}
+
+// serveObject writes the object stored under key, honouring Range and
+// conditional request headers.
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, key string) {
+	info, err := s.objects.GetObjectInfo(key)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Object not found")
+		return
+	}
+	data, ok := s.Object(key)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Object not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("ETag", info.ETag)
+	http.ServeContent(w, r, "", info.LastModified, bytes.NewReader(data))
+}
+
+// issue hands out a token for a signed URL to key.
+func (s *Server) issue(key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := uuid.NewString()
+	s.signed[token] = key
+	return token
+}
+
+// redeem reports whether token was issued for key.
+func (s *Server) redeem(token, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return token != "" && s.signed[token] == key
+}
+
+func mediaType(r *http.Request) string {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return contentType
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"statusCode": http.StatusText(status),
+		"error":      http.StatusText(status),
+		"message":    message,
+	})
+}
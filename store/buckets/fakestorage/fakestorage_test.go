@@ -0,0 +1,257 @@
+package fakestorage_test
+
+import (
+	"fm/models"
+	"fm/store"
+	"fm/store/buckets"
+	"fm/store/buckets/fakestorage"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/syntaxLabz/errors/pkg/codes"
+)
+
+// setup starts a server and the REST driver talking to it.
+func setup(t *testing.T) (*fakestorage.Server, store.Bucket) {
+	t.Helper()
+
+	server := fakestorage.New("token")
+	t.Cleanup(server.Close)
+	return server, buckets.New(server.URL, "views", "token")
+}
+
+func read(t *testing.T, bucket store.Bucket, key string, offset, length int64) string {
+	t.Helper()
+
+	body, err := bucket.GetObject(key, offset, length)
+	if err != nil {
+		t.Fatalf("GetObject(%q) failed: %v", key, err)
+	}
+	defer body.Close()
+
+	data, readErr := io.ReadAll(body)
+	if readErr != nil {
+		t.Fatalf("reading %q failed: %v", key, readErr)
+	}
+	return string(data)
+}
+
+func put(t *testing.T, bucket store.Bucket, key, content string) {
+	t.Helper()
+
+	if err := bucket.PutObject(key, strings.NewReader(content), "text/plain"); err != nil {
+		t.Fatalf("PutObject(%q) failed: %v", key, err)
+	}
+}
+
+func TestPutAndGetObject(t *testing.T) {
+	server, bucket := setup(t)
+	put(t, bucket, "views/docs/a.txt", "0123456789")
+
+	if data, ok := server.Object("views/docs/a.txt"); !ok || string(data) != "0123456789" {
+		t.Errorf("server holds %q, want %q", data, "0123456789")
+	}
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           string
+	}{
+		{"whole object", 0, -1, "0123456789"},
+		{"from offset", 4, -1, "456789"},
+		{"range", 2, 3, "234"},
+		{"empty range", 3, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := read(t, bucket, "views/docs/a.txt", tt.offset, tt.length); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	info, err := bucket.GetObjectInfo("views/docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 10 || info.ContentType != "text/plain" {
+		t.Errorf("got size %d and type %q, want 10 and text/plain", info.Size, info.ContentType)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	server, _ := setup(t)
+	bucket := buckets.New(server.URL, "views", "wrong")
+
+	if err := bucket.PutObject("views/a", strings.NewReader("a"), ""); err == nil {
+		t.Error("PutObject with a wrong token succeeded")
+	}
+	if len(server.Objects()) != 0 {
+		t.Errorf("got objects %v, want none", server.Objects())
+	}
+}
+
+func TestCopyMoveDelete(t *testing.T) {
+	server, bucket := setup(t)
+	put(t, bucket, "views/a", "a")
+
+	if err := bucket.CopyObject("views/a", "views/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.MoveObject("views/a", "views/c"); err != nil {
+		t.Fatal(err)
+	}
+	// moving what isn't there is not an error
+	if err := bucket.MoveObject("views/a", "views/d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.DeleteObject("views/b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := server.Objects(), []string{"views/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+	if _, err := bucket.GetObjectInfo("views/a"); err == nil || err.Code != codes.NotFound {
+		t.Errorf("got %v, want a not found error", err)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	_, bucket := setup(t)
+	for _, key := range []string{"views/docs/a", "views/docs/sub/b", "views/docsx/c", "views/other"} {
+		put(t, bucket, key, key)
+	}
+
+	objects, err := bucket.ListObjects("views/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	if want := []string{"views/docs/a", "views/docs/sub/b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %v, want %v", keys, want)
+	}
+}
+
+func TestMoveFolder(t *testing.T) {
+	server, bucket := setup(t)
+	if _, err := bucket.CreateFolder("/docs"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, bucket, "views/docs/sub/a", "a")
+	put(t, bucket, "views/docsx/b", "b")
+
+	if err := bucket.MoveFolder("/docs", "/archive/docs"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"views/archive/docs/.keep", "views/archive/docs/sub/a", "views/docsx/b"}
+	if got := server.Objects(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+}
+
+func TestSignedURLs(t *testing.T) {
+	server, bucket := setup(t)
+
+	upload, err := bucket.GeneratePresignedUploadURL("/docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, reqErr := http.NewRequest(http.MethodPut, upload.URL, strings.NewReader("signed"))
+	if reqErr != nil {
+		t.Fatal(reqErr)
+	}
+	resp, reqErr := http.DefaultClient.Do(req)
+	if reqErr != nil {
+		t.Fatal(reqErr)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("signed upload answered %d", resp.StatusCode)
+	}
+	if data, ok := server.Object(upload.S3Key); !ok || string(data) != "signed" {
+		t.Errorf("server holds %q, want %q", data, "signed")
+	}
+
+	download, err := bucket.GeneratePresignedDownloadURL(upload.S3Key, models.DownloadOptions{Disposition: "attachment", FileName: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, reqErr = http.Get(download.URL)
+	if reqErr != nil {
+		t.Fatal(reqErr)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "signed" {
+		t.Errorf("signed download got %q, want %q", data, "signed")
+	}
+	if disposition := resp.Header.Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment") {
+		t.Errorf("got Content-Disposition %q, want an attachment", disposition)
+	}
+
+	// a token only signs the key it was issued for
+	resp, reqErr = http.Get(strings.Replace(download.URL, "a.txt?", "b.txt?", 1))
+	if reqErr != nil {
+		t.Fatal(reqErr)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("download of another key answered %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	server, bucket := setup(t)
+
+	uploadId, err := bucket.CreateMultipartUpload("views/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for number, data := range map[int]string{2: "world", 1: "hello "} {
+		if err := bucket.UploadPart("views/big", uploadId, number, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parts := []models.UploadPart{{PartNumber: 1}, {PartNumber: 2}}
+	if err := bucket.CompleteMultipartUpload("views/big", uploadId, parts); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, bucket, "views/big", 0, -1); got != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+	// the staged parts are removed once assembled
+	if got, want := server.Objects(), []string{"views/big"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	server, bucket := setup(t)
+
+	uploadId, err := bucket.CreateMultipartUpload("views/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.UploadPart("views/big", uploadId, 1, strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := bucket.UploadPart("views/big", uploadId, 2, strings.NewReader("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the parts reported don't have to cover what was staged
+	if err := bucket.AbortMultipartUpload("views/big", uploadId, []models.UploadPart{{PartNumber: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Objects()) != 0 {
+		t.Errorf("got objects %v, want none", server.Objects())
+	}
+}
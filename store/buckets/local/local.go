@@ -0,0 +1,393 @@
+package local
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fm/models"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// multipartDir holds the staged parts of multipart uploads, below the root.
+const multipartDir = ".multipart"
+
+// bucket stores objects as plain files below a root directory. The S3Key of an
+// object, bucket name included, is its path relative to the root.
+type bucket struct {
+	root       string
+	bucketName string
+	// publicURL is where the routes serving signed URLs are reachable
+	publicURL string
+	secret    []byte
+}
+
+func New(root, bucketName, publicURL, secret string) (*bucket, error) {
+	if secret == "" {
+		return nil, errors.New("a secret is required to sign storage URLs")
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, bucketName), 0o755); err != nil {
+		return nil, err
+	}
+	return &bucket{
+		root:       root,
+		bucketName: bucketName,
+		publicURL:  strings.TrimSuffix(publicURL, "/"),
+		secret:     []byte(secret),
+	}, nil
+}
+
+func (b *bucket) ObjectKey(fullPath string) string {
+	return b.bucketName + fullPath
+}
+
+// filePath maps key to a path inside the bucket directory. Keys come from
+// folder and file paths chosen by users, so any ".." segment is refused
+// outright rather than resolved, and the result is checked to stay inside
+// the bucket directory.
+func (b *bucket) filePath(key string) (string, *httperrors.Error) {
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return "", httperrors.New(codes.BadRequest, "Invalid object key")
+		}
+	}
+	if strings.ContainsAny(key, "\x00\\") {
+		return "", httperrors.New(codes.BadRequest, "Invalid object key")
+	}
+
+	bucketDir := filepath.Join(b.root, b.bucketName)
+	filePath := filepath.Join(b.root, filepath.FromSlash(path.Clean("/"+key)))
+	if filePath == bucketDir || !strings.HasPrefix(filePath, bucketDir+string(filepath.Separator)) {
+		return "", httperrors.New(codes.BadRequest, "Invalid object key")
+	}
+	return filePath, nil
+}
+
+func (b *bucket) PutObject(key string, body io.Reader, contentType string) *httperrors.Error {
+	filePath, err := b.filePath(key)
+	if err != nil {
+		return err
+	}
+	return writeFile(filePath, body)
+}
+
+// writeFile writes body to a temporary file next to filePath and renames it in
+// place, so readers never see a partially written object.
+func writeFile(filePath string, body io.Reader) *httperrors.Error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return storageError(err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(filePath), ".upload-*")
+	if err != nil {
+		return storageError(err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, body); err != nil {
+		temp.Close()
+		return httperrors.New(codes.BadRequest, err.Error())
+	}
+	if err := temp.Close(); err != nil {
+		return storageError(err)
+	}
+	if err := os.Rename(temp.Name(), filePath); err != nil {
+		return storageError(err)
+	}
+	return nil
+}
+
+func (b *bucket) GetObject(key string, offset, length int64) (io.ReadCloser, *httperrors.Error) {
+	filePath, err := b.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, openErr := os.Open(filePath)
+	if openErr != nil {
+		return nil, storageError(openErr)
+	}
+
+	if offset > 0 {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, storageError(err)
+		}
+	}
+	if length < 0 {
+		return file, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(file, length), file}, nil
+}
+
+func (b *bucket) GetObjectInfo(key string) (*models.ObjectInfo, *httperrors.Error) {
+	filePath, err := b.filePath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, statErr := os.Stat(filePath)
+	if statErr != nil {
+		return nil, storageError(statErr)
+	}
+	if stat.IsDir() {
+		return nil, httperrors.New(codes.NotFound, "Object not found")
+	}
+
+	return &models.ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  contentType(filePath),
+		ETag:         etag(stat),
+		LastModified: stat.ModTime().UTC(),
+	}, nil
+}
+
+// DeleteObject removes the object stored under key; a missing object is not an error.
+func (b *bucket) DeleteObject(key string) *httperrors.Error {
+	filePath, err := b.filePath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return storageError(err)
+	}
+	return nil
+}
+
+func (b *bucket) CopyObject(sourceKey, destinationKey string) *httperrors.Error {
+	source, err := b.GetObject(sourceKey, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	return b.PutObject(destinationKey, source, "")
+}
+
+// MoveObject renames the object; a missing source object is not an error.
+func (b *bucket) MoveObject(sourceKey, destinationKey string) *httperrors.Error {
+	sourcePath, err := b.filePath(sourceKey)
+	if err != nil {
+		return err
+	}
+	destinationPath, err := b.filePath(destinationKey)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destinationPath), 0o755); err != nil {
+		return storageError(err)
+	}
+	if err := os.Rename(sourcePath, destinationPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return storageError(err)
+	}
+	return nil
+}
+
+func (b *bucket) ListObjects(prefix string) ([]models.ObjectInfo, *httperrors.Error) {
+	directory := filepath.Join(b.root, b.bucketName)
+	if strings.Trim(prefix, "/") != b.bucketName {
+		var err *httperrors.Error
+		directory, err = b.filePath(prefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var objects []models.ObjectInfo
+	walkErr := filepath.WalkDir(directory, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".upload-") {
+			return nil
+		}
+
+		stat, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(b.root, filePath)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, models.ObjectInfo{
+			Key:          filepath.ToSlash(relative),
+			Size:         stat.Size(),
+			ContentType:  contentType(filePath),
+			ETag:         etag(stat),
+			LastModified: stat.ModTime().UTC(),
+		})
+		return nil
+	})
+	if walkErr != nil {
+		return nil, storageError(walkErr)
+	}
+	return objects, nil
+}
+
+func (b *bucket) CreateFolder(fullPath string) (*models.CreateObjectResponse, *httperrors.Error) {
+	key := b.ObjectKey(fullPath + "/.keep")
+	if err := b.PutObject(key, strings.NewReader(""), ""); err != nil {
+		return nil, err
+	}
+	return &models.CreateObjectResponse{Key: key, Id: uuid.New()}, nil
+}
+
+func (b *bucket) DeleteFolder(fullPath string) *httperrors.Error {
+	if err := b.DeleteObject(b.ObjectKey(fullPath + "/.keep")); err != nil {
+		return err
+	}
+
+	// drop the directory itself once nothing else lives in it
+	directory, err := b.filePath(b.ObjectKey(fullPath))
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(directory); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Println("folder directory not removed", directory, err)
+	}
+	return nil
+}
+
+// MoveFolder renames the directory of oldPath, and with it every object
+// stored below it, to that of newPath. A missing directory is not an error.
+func (b *bucket) MoveFolder(oldPath, newPath string) *httperrors.Error {
+	oldDirectory, err := b.filePath(b.ObjectKey(oldPath))
+	if err != nil {
+		return err
+	}
+	newDirectory, err := b.filePath(b.ObjectKey(newPath))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newDirectory), 0o755); err != nil {
+		return storageError(err)
+	}
+	if err := os.Rename(oldDirectory, newDirectory); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return storageError(err)
+	}
+	return nil
+}
+
+// Multipart uploads stage every part as a file below multipartDir and
+// concatenate them into the object on completion.
+
+func (b *bucket) partPath(uploadId string, partNumber int) (string, *httperrors.Error) {
+	if _, err := uuid.Parse(uploadId); err != nil {
+		return "", httperrors.New(codes.BadRequest, "Invalid upload id")
+	}
+	return filepath.Join(b.root, multipartDir, uploadId, fmt.Sprintf("%05d", partNumber)), nil
+}
+
+func (b *bucket) CreateMultipartUpload(key string) (string, *httperrors.Error) {
+	return uuid.NewString(), nil
+}
+
+func (b *bucket) UploadPart(key, uploadId string, partNumber int, body io.Reader) *httperrors.Error {
+	partPath, err := b.partPath(uploadId, partNumber)
+	if err != nil {
+		return err
+	}
+	return writeFile(partPath, body)
+}
+
+func (b *bucket) CompleteMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error {
+	reader, writer := io.Pipe()
+
+	go func() {
+		for _, part := range parts {
+			partPath, err := b.partPath(uploadId, part.PartNumber)
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			file, openErr := os.Open(partPath)
+			if openErr != nil {
+				writer.CloseWithError(openErr)
+				return
+			}
+			_, copyErr := io.Copy(writer, file)
+			file.Close()
+			if copyErr != nil {
+				writer.CloseWithError(copyErr)
+				return
+			}
+		}
+		writer.Close()
+	}()
+
+	if err := b.PutObject(key, reader, ""); err != nil {
+		reader.CloseWithError(err)
+		return err
+	}
+
+	return b.AbortMultipartUpload(key, uploadId, parts)
+}
+
+// AbortMultipartUpload removes every staged part of the upload.
+func (b *bucket) AbortMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error {
+	if _, err := uuid.Parse(uploadId); err != nil {
+		return httperrors.New(codes.BadRequest, "Invalid upload id")
+	}
+	if err := os.RemoveAll(filepath.Join(b.root, multipartDir, uploadId)); err != nil {
+		return storageError(err)
+	}
+	return nil
+}
+
+// contentType guesses the MIME type of a stored file, from its extension when
+// known and from its first bytes otherwise.
+func contentType(filePath string) string {
+	if byExtension := mime.TypeByExtension(filepath.Ext(filePath)); byExtension != "" {
+		return byExtension
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	return http.DetectContentType(head[:n])
+}
+
+func etag(stat fs.FileInfo) string {
+	sum := md5.Sum([]byte(fmt.Sprintf("%d-%d", stat.ModTime().UnixNano(), stat.Size())))
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func storageError(err error) *httperrors.Error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return httperrors.New(codes.NotFound, "Object not found")
+	}
+	log.Println("local storage operation failed:", err)
+	return httperrors.NewDBError()
+}
@@ -0,0 +1,285 @@
+package memory
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fm/models"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// bucket keeps objects in memory. It needs no storage server, which makes it
+// suited for tests and throwaway setups; everything is lost on restart.
+// Presigned URLs use a memory:// scheme and can't be fetched, but Objects
+// exposes what was stored.
+type bucket struct {
+	bucketName string
+
+	mu        sync.RWMutex
+	objects   map[string]*object
+	multipart map[string]map[int][]byte
+}
+
+type object struct {
+	data         []byte
+	contentType  string
+	lastModified time.Time
+}
+
+func New(bucketName string) *bucket {
+	return &bucket{
+		bucketName: bucketName,
+		objects:    make(map[string]*object),
+		multipart:  make(map[string]map[int][]byte),
+	}
+}
+
+func (b *bucket) ObjectKey(fullPath string) string {
+	return b.bucketName + fullPath
+}
+
+// Objects returns the keys of every stored object, sorted.
+func (b *bucket) Objects() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	keys := make([]string, 0, len(b.objects))
+	for key := range b.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (b *bucket) PutObject(key string, body io.Reader, contentType string) *httperrors.Error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return httperrors.New(codes.BadRequest, err.Error())
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.objects[key] = &object{data: data, contentType: contentType, lastModified: time.Now().UTC()}
+	return nil
+}
+
+func (b *bucket) GetObject(key string, offset, length int64) (io.ReadCloser, *httperrors.Error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stored, ok := b.objects[key]
+	if !ok {
+		return nil, httperrors.New(codes.NotFound, "Object not found")
+	}
+
+	data := stored.data
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (b *bucket) GetObjectInfo(key string) (*models.ObjectInfo, *httperrors.Error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stored, ok := b.objects[key]
+	if !ok {
+		return nil, httperrors.New(codes.NotFound, "Object not found")
+	}
+	return info(key, stored), nil
+}
+
+func (b *bucket) DeleteObject(key string) *httperrors.Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.objects, key)
+	return nil
+}
+
+func (b *bucket) CopyObject(sourceKey, destinationKey string) *httperrors.Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stored, ok := b.objects[sourceKey]
+	if !ok {
+		return httperrors.New(codes.NotFound, "Object not found")
+	}
+	copied := *stored
+	copied.lastModified = time.Now().UTC()
+	b.objects[destinationKey] = &copied
+	return nil
+}
+
+// MoveObject renames the object; a missing source object is not an error.
+func (b *bucket) MoveObject(sourceKey, destinationKey string) *httperrors.Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if stored, ok := b.objects[sourceKey]; ok {
+		delete(b.objects, sourceKey)
+		b.objects[destinationKey] = stored
+	}
+	return nil
+}
+
+func (b *bucket) ListObjects(prefix string) ([]models.ObjectInfo, *httperrors.Error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	directory := strings.TrimSuffix(prefix, "/") + "/"
+	var objects []models.ObjectInfo
+	for key, stored := range b.objects {
+		if strings.HasPrefix(key, directory) {
+			objects = append(objects, *info(key, stored))
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+func (b *bucket) CreateFolder(fullPath string) (*models.CreateObjectResponse, *httperrors.Error) {
+	key := b.ObjectKey(fullPath + "/.keep")
+	if err := b.PutObject(key, strings.NewReader(""), ""); err != nil {
+		return nil, err
+	}
+	return &models.CreateObjectResponse{Key: key, Id: uuid.New()}, nil
+}
+
+func (b *bucket) DeleteFolder(fullPath string) *httperrors.Error {
+	return b.DeleteObject(b.ObjectKey(fullPath + "/.keep"))
+}
+
+// MoveFolder moves every object stored below oldPath to the same place below
+// newPath.
+func (b *bucket) MoveFolder(oldPath, newPath string) *httperrors.Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	oldPrefix := b.ObjectKey(oldPath) + "/"
+	newPrefix := b.ObjectKey(newPath) + "/"
+	for key, stored := range b.objects {
+		if strings.HasPrefix(key, oldPrefix) {
+			delete(b.objects, key)
+			b.objects[newPrefix+strings.TrimPrefix(key, oldPrefix)] = stored
+		}
+	}
+	return nil
+}
+
+func (b *bucket) GeneratePresignedUploadURL(fullPath string) (*models.UploadSignedURLResponse, *httperrors.Error) {
+	key := b.ObjectKey(fullPath)
+	token := uuid.NewString()
+	return &models.UploadSignedURLResponse{
+		URL:   "memory://" + key + "?op=upload&token=" + token,
+		Token: token,
+		S3Key: key,
+	}, nil
+}
+
+func (b *bucket) GeneratePresignedDownloadURL(key string, opts models.DownloadOptions) (*models.DownloadSignedURLResponse, *httperrors.Error) {
+	if _, err := b.GetObjectInfo(key); err != nil {
+		return nil, err
+	}
+	return &models.DownloadSignedURLResponse{
+		URL:         "memory://" + key + "?op=download&disposition=" + opts.Disposition,
+		ExpiresAt:   time.Now().UTC().Add(opts.ExpiresIn),
+		Disposition: opts.Disposition,
+		FileName:    opts.FileName,
+		MimeType:    opts.MimeType,
+	}, nil
+}
+
+func (b *bucket) CreateMultipartUpload(key string) (string, *httperrors.Error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	uploadId := uuid.NewString()
+	b.multipart[uploadId] = make(map[int][]byte)
+	return uploadId, nil
+}
+
+func (b *bucket) GeneratePresignedPartURL(key, uploadId string, partNumber int) (*models.UploadSignedURLResponse, *httperrors.Error) {
+	return &models.UploadSignedURLResponse{
+		URL:   fmt.Sprintf("memory://%s?op=part&upload_id=%s&part_number=%d", key, uploadId, partNumber),
+		S3Key: key,
+	}, nil
+}
+
+func (b *bucket) UploadPart(key, uploadId string, partNumber int, body io.Reader) *httperrors.Error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return httperrors.New(codes.BadRequest, err.Error())
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	parts, ok := b.multipart[uploadId]
+	if !ok {
+		return httperrors.New(codes.NotFound, "Upload not found")
+	}
+	parts[partNumber] = data
+	return nil
+}
+
+func (b *bucket) CompleteMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error {
+	b.mu.Lock()
+	stored, ok := b.multipart[uploadId]
+	if !ok {
+		b.mu.Unlock()
+		return httperrors.New(codes.NotFound, "Upload not found")
+	}
+
+	var data bytes.Buffer
+	for _, part := range parts {
+		partData, ok := stored[part.PartNumber]
+		if !ok {
+			b.mu.Unlock()
+			return httperrors.New(codes.Conflict, fmt.Sprintf("Part %d has not been uploaded", part.PartNumber))
+		}
+		data.Write(partData)
+	}
+	delete(b.multipart, uploadId)
+	b.mu.Unlock()
+
+	return b.PutObject(key, &data, "")
+}
+
+func (b *bucket) AbortMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.multipart, uploadId)
+	return nil
+}
+
+func info(key string, stored *object) *models.ObjectInfo {
+	sum := md5.Sum(stored.data)
+	return &models.ObjectInfo{
+		Key:          key,
+		Size:         int64(len(stored.data)),
+		ContentType:  stored.contentType,
+		ETag:         `"` + hex.EncodeToString(sum[:]) + `"`,
+		LastModified: stored.lastModified,
+	}
+}
@@ -0,0 +1,236 @@
+package memory
+
+import (
+	"fm/models"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/syntaxLabz/errors/pkg/codes"
+)
+
+func read(t *testing.T, b *bucket, key string, offset, length int64) string {
+	t.Helper()
+
+	body, err := b.GetObject(key, offset, length)
+	if err != nil {
+		t.Fatalf("GetObject(%q) failed: %v", key, err)
+	}
+	defer body.Close()
+
+	data, readErr := io.ReadAll(body)
+	if readErr != nil {
+		t.Fatalf("reading %q failed: %v", key, readErr)
+	}
+	return string(data)
+}
+
+func put(t *testing.T, b *bucket, key, content string) {
+	t.Helper()
+
+	if err := b.PutObject(key, strings.NewReader(content), ""); err != nil {
+		t.Fatalf("PutObject(%q) failed: %v", key, err)
+	}
+}
+
+func TestGetObjectRanges(t *testing.T) {
+	b := New("views")
+	put(t, b, "views/a.txt", "0123456789")
+
+	tests := []struct {
+		name           string
+		offset, length int64
+		want           string
+	}{
+		{"whole object", 0, -1, "0123456789"},
+		{"from offset", 4, -1, "456789"},
+		{"range", 2, 3, "234"},
+		{"range past the end", 8, 10, "89"},
+		{"offset past the end", 20, -1, ""},
+		{"empty range", 3, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := read(t, b, "views/a.txt", tt.offset, tt.length); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetObjectNotFound(t *testing.T) {
+	b := New("views")
+
+	if _, err := b.GetObject("views/missing", 0, -1); err == nil || err.Code != codes.NotFound {
+		t.Errorf("got %v, want a not found error", err)
+	}
+	if _, err := b.GetObjectInfo("views/missing"); err == nil || err.Code != codes.NotFound {
+		t.Errorf("got %v, want a not found error", err)
+	}
+}
+
+func TestObjectInfo(t *testing.T) {
+	b := New("views")
+	if err := b.PutObject("views/a.txt", strings.NewReader("hello"), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := b.GetObjectInfo("views/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 || info.ContentType != "text/plain" {
+		t.Errorf("got size %d and type %q, want 5 and text/plain", info.Size, info.ContentType)
+	}
+	// the md5 of "hello"
+	if info.ETag != `"5d41402abc4b2a76b9719d911017c592"` {
+		t.Errorf("got ETag %s", info.ETag)
+	}
+}
+
+func TestCopyMoveDelete(t *testing.T) {
+	b := New("views")
+	put(t, b, "views/a", "a")
+
+	if err := b.CopyObject("views/a", "views/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.MoveObject("views/a", "views/c"); err != nil {
+		t.Fatal(err)
+	}
+	// moving what isn't there is not an error
+	if err := b.MoveObject("views/a", "views/d"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CopyObject("views/a", "views/e"); err == nil || err.Code != codes.NotFound {
+		t.Errorf("copying a missing object: got %v, want a not found error", err)
+	}
+
+	if got, want := b.Objects(), []string{"views/b", "views/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+
+	if err := b.DeleteObject("views/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DeleteObject("views/missing"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Objects(), []string{"views/c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	b := New("views")
+	for _, key := range []string{"views/docs/a", "views/docs/sub/b", "views/docsx/c", "views/other"} {
+		put(t, b, key, key)
+	}
+
+	objects, err := b.ListObjects("views/docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	// a sibling sharing the prefix as a string is not below it
+	if want := []string{"views/docs/a", "views/docs/sub/b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %v, want %v", keys, want)
+	}
+}
+
+func TestFolders(t *testing.T) {
+	b := New("views")
+	if _, err := b.CreateFolder("/docs"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, b, "views/docs/a", "a")
+	put(t, b, "views/docsx/b", "b")
+
+	if err := b.MoveFolder("/docs", "/archive/docs"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"views/archive/docs/.keep", "views/archive/docs/a", "views/docsx/b"}
+	if got := b.Objects(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+
+	if err := b.DeleteFolder("/archive/docs"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"views/archive/docs/a", "views/docsx/b"}
+	if got := b.Objects(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got objects %v, want %v", got, want)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	b := New("views")
+
+	uploadId, err := b.CreateMultipartUpload("views/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// parts may arrive in any order; the list given to complete decides
+	for number, data := range map[int]string{2: "world", 1: "hello ", 3: "unused"} {
+		if err := b.UploadPart("views/big", uploadId, number, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	parts := []models.UploadPart{{PartNumber: 1}, {PartNumber: 2}}
+	if err := b.CompleteMultipartUpload("views/big", uploadId, parts); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, b, "views/big", 0, -1); got != "hello world" {
+		t.Errorf("got %q, want %q", got, "hello world")
+	}
+
+	// a completed upload is gone
+	if err := b.UploadPart("views/big", uploadId, 1, strings.NewReader("x")); err == nil || err.Code != codes.NotFound {
+		t.Errorf("got %v, want a not found error", err)
+	}
+}
+
+func TestMultipartUploadMissingPart(t *testing.T) {
+	b := New("views")
+
+	uploadId, err := b.CreateMultipartUpload("views/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UploadPart("views/big", uploadId, 1, strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := []models.UploadPart{{PartNumber: 1}, {PartNumber: 2}}
+	if err := b.CompleteMultipartUpload("views/big", uploadId, parts); err == nil || err.Code != codes.Conflict {
+		t.Errorf("got %v, want a conflict", err)
+	}
+	if len(b.Objects()) != 0 {
+		t.Errorf("got objects %v, want none", b.Objects())
+	}
+}
+
+func TestAbortMultipartUpload(t *testing.T) {
+	b := New("views")
+
+	uploadId, err := b.CreateMultipartUpload("views/big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.UploadPart("views/big", uploadId, 1, strings.NewReader("a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AbortMultipartUpload("views/big", uploadId, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	parts := []models.UploadPart{{PartNumber: 1}}
+	if err := b.CompleteMultipartUpload("views/big", uploadId, parts); err == nil || err.Code != codes.NotFound {
+		t.Errorf("got %v, want a not found error", err)
+	}
+}
@@ -0,0 +1,170 @@
+package buckets
+
+import (
+	"fm/models"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// The storage REST API has no native multipart uploads, so they are emulated:
+// every part is uploaded as its own object under a staging prefix next to the
+// final key, and completing the upload streams the parts, in order, into the
+// final object before removing them.
+
+func (b *buckets) partKey(key, uploadId string, partNumber int) string {
+	return fmt.Sprintf("%s.parts/%s/%05d", key, uploadId, partNumber)
+}
+
+func (b *buckets) CreateMultipartUpload(key string) (string, *httperrors.Error) {
+	return uuid.NewString(), nil
+}
+
+func (b *buckets) GeneratePresignedPartURL(key, uploadId string, partNumber int) (*models.UploadSignedURLResponse, *httperrors.Error) {
+	return b.signUpload(b.partKey(key, uploadId, partNumber))
+}
+
+// CompleteMultipartUpload concatenates parts into the object stored under key.
+// Parts are read one at a time, so only a single part is in flight at once.
+func (b *buckets) CompleteMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error {
+	reader, writer := io.Pipe()
+
+	go func() {
+		for _, part := range parts {
+			body, _, err := b.openObject(b.partKey(key, uploadId, part.PartNumber), 0, -1)
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			_, copyErr := io.Copy(writer, body)
+			body.Close()
+			if copyErr != nil {
+				writer.CloseWithError(copyErr)
+				return
+			}
+		}
+		writer.Close()
+	}()
+
+	if err := b.putObject(key, reader, ""); err != nil {
+		reader.CloseWithError(err)
+		return httperrors.NewDBError()
+	}
+
+	return b.AbortMultipartUpload(key, uploadId, parts)
+}
+
+// UploadPart streams body into the staged object of a part.
+func (b *buckets) UploadPart(key, uploadId string, partNumber int, body io.Reader) *httperrors.Error {
+	if err := b.putObject(b.partKey(key, uploadId, partNumber), body, "application/octet-stream"); err != nil {
+		return httperrors.NewDBError()
+	}
+	return nil
+}
+
+// AbortMultipartUpload removes the staged parts of an upload. The whole
+// staging prefix is swept, so parts uploaded but never reported go too.
+func (b *buckets) AbortMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error {
+	staged, err := b.ListObjects(fmt.Sprintf("%s.parts/%s", key, uploadId))
+	if err != nil {
+		return err
+	}
+	for _, part := range staged {
+		if err := b.DeleteObject(part.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetObject streams length bytes of the object stored under key, starting at
+// offset. A negative length reads up to the end of the object. The caller
+// closes the returned body.
+func (b *buckets) GetObject(key string, offset, length int64) (io.ReadCloser, *httperrors.Error) {
+	body, status, err := b.openObject(key, offset, length)
+	if err != nil {
+		if status == http.StatusNotFound || status == http.StatusBadRequest {
+			return nil, httperrors.New(codes.NotFound, "Object not found")
+		}
+		return nil, httperrors.NewDBError()
+	}
+	return body, nil
+}
+
+// openObject starts reading the object stored under key, optionally limited
+// to a byte range. On failure it also returns the status the API answered
+// with, if any. The caller closes the body.
+func (b *buckets) openObject(key string, offset, length int64) (io.ReadCloser, int, error) {
+	// an empty range can't be expressed in a Range header
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), http.StatusOK, nil
+	}
+
+	url := fmt.Sprintf("%s/object/%s", b.baseURL, strings.TrimPrefix(key, "/"))
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req.Header.Set("Authorization", b.serviceToken)
+	switch {
+	case length >= 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := b.streamClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, resp.StatusCode, fmt.Errorf("reading object %s: unexpected status %d", key, resp.StatusCode)
+	}
+
+	return resp.Body, resp.StatusCode, nil
+}
+
+// PutObject streams body into the object stored under key.
+func (b *buckets) PutObject(key string, body io.Reader, contentType string) *httperrors.Error {
+	if err := b.putObject(key, body, contentType); err != nil {
+		return httperrors.NewDBError()
+	}
+	return nil
+}
+
+// putObject streams body into the object stored under key, replacing any
+// existing object. An empty contentType leaves detection to the storage API.
+func (b *buckets) putObject(key string, body io.Reader, contentType string) error {
+	url := fmt.Sprintf("%s/object/%s", b.baseURL, strings.TrimPrefix(key, "/"))
+
+	req, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", b.serviceToken)
+	req.Header.Set("x-upsert", "true")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := b.streamClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("writing object %s: unexpected status %d", key, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,395 @@
+package s3
+
+import (
+	"errors"
+	"fm/models"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// uploadURLExpiry is how long presigned upload and part URLs stay valid.
+const uploadURLExpiry = 15 * time.Minute
+
+// bucket stores objects in an S3 bucket, or any S3 compatible service when an
+// endpoint is configured.
+type bucket struct {
+	bucketName string
+	client     *awss3.S3
+	uploader   *s3manager.Uploader
+}
+
+func New(region, endpoint, bucketName, accessKeyId, secretAccessKey string, forcePathStyle bool) (*bucket, error) {
+	config := aws.NewConfig().
+		WithRegion(region).
+		WithS3ForcePathStyle(forcePathStyle)
+	if endpoint != "" {
+		config = config.WithEndpoint(endpoint)
+	}
+	// without static keys the default chain (env, shared config, instance role) is used
+	if accessKeyId != "" {
+		config = config.WithCredentials(credentials.NewStaticCredentials(accessKeyId, secretAccessKey, ""))
+	}
+
+	sess, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bucket{
+		bucketName: bucketName,
+		client:     awss3.New(sess),
+		uploader:   s3manager.NewUploader(sess),
+	}, nil
+}
+
+func (b *bucket) ObjectKey(fullPath string) string {
+	return b.bucketName + fullPath
+}
+
+// objectName strips the bucket name from key, leaving the S3 object key.
+func (b *bucket) objectName(key string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(key, b.bucketName), "/")
+}
+
+func (b *bucket) PutObject(key string, body io.Reader, contentType string) *httperrors.Error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(b.bucketName),
+		Key:    aws.String(b.objectName(key)),
+		Body:   body,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	if _, err := b.uploader.Upload(input); err != nil {
+		return storageError(err)
+	}
+	return nil
+}
+
+func (b *bucket) GetObject(key string, offset, length int64) (io.ReadCloser, *httperrors.Error) {
+	// an empty range can't be expressed in a Range header
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	input := &awss3.GetObjectInput{
+		Bucket: aws.String(b.bucketName),
+		Key:    aws.String(b.objectName(key)),
+	}
+	switch {
+	case length >= 0:
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	output, err := b.client.GetObject(input)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return output.Body, nil
+}
+
+func (b *bucket) GetObjectInfo(key string) (*models.ObjectInfo, *httperrors.Error) {
+	output, err := b.client.HeadObject(&awss3.HeadObjectInput{
+		Bucket: aws.String(b.bucketName),
+		Key:    aws.String(b.objectName(key)),
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+
+	return &models.ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(output.ContentLength),
+		ContentType:  aws.StringValue(output.ContentType),
+		ETag:         aws.StringValue(output.ETag),
+		LastModified: aws.TimeValue(output.LastModified),
+	}, nil
+}
+
+// DeleteObject removes the object stored under key. S3 deletes are
+// idempotent, so a missing object is not an error.
+func (b *bucket) DeleteObject(key string) *httperrors.Error {
+	_, err := b.client.DeleteObject(&awss3.DeleteObjectInput{
+		Bucket: aws.String(b.bucketName),
+		Key:    aws.String(b.objectName(key)),
+	})
+	if err != nil {
+		return storageError(err)
+	}
+	return nil
+}
+
+func (b *bucket) CopyObject(sourceKey, destinationKey string) *httperrors.Error {
+	_, err := b.client.CopyObject(&awss3.CopyObjectInput{
+		Bucket:     aws.String(b.bucketName),
+		Key:        aws.String(b.objectName(destinationKey)),
+		CopySource: aws.String(url.PathEscape(b.bucketName + "/" + b.objectName(sourceKey))),
+	})
+	if err != nil {
+		return storageError(err)
+	}
+	return nil
+}
+
+// MoveObject copies the object to destinationKey and removes the source, since
+// S3 has no rename. A missing source object is not treated as an error.
+func (b *bucket) MoveObject(sourceKey, destinationKey string) *httperrors.Error {
+	if err := b.CopyObject(sourceKey, destinationKey); err != nil {
+		if err.Code == codes.NotFound {
+			return nil
+		}
+		return err
+	}
+	return b.DeleteObject(sourceKey)
+}
+
+func (b *bucket) ListObjects(prefix string) ([]models.ObjectInfo, *httperrors.Error) {
+	var objects []models.ObjectInfo
+
+	directory := strings.Trim(b.objectName(prefix), "/")
+	if directory != "" {
+		directory += "/"
+	}
+
+	err := b.client.ListObjectsV2Pages(&awss3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucketName),
+		Prefix: aws.String(directory),
+	}, func(page *awss3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			objects = append(objects, models.ObjectInfo{
+				Key:          b.ObjectKey("/" + aws.StringValue(object.Key)),
+				Size:         aws.Int64Value(object.Size),
+				ETag:         aws.StringValue(object.ETag),
+				LastModified: aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return objects, nil
+}
+
+// CreateFolder writes the empty .keep marker of a folder. S3 doesn't hand out
+// object ids, so the folder id is generated here.
+func (b *bucket) CreateFolder(fullPath string) (*models.CreateObjectResponse, *httperrors.Error) {
+	key := b.ObjectKey(fullPath + "/.keep")
+	if err := b.PutObject(key, strings.NewReader(""), ""); err != nil {
+		return nil, err
+	}
+	return &models.CreateObjectResponse{Key: key, Id: uuid.New()}, nil
+}
+
+func (b *bucket) DeleteFolder(fullPath string) *httperrors.Error {
+	return b.DeleteObject(b.ObjectKey(fullPath + "/.keep"))
+}
+
+// MoveFolder moves every object stored below oldPath to the same place below
+// newPath, one object at a time since S3 has no prefix rename. On error the
+// objects moved so far stay at newPath; moving back undoes the move.
+func (b *bucket) MoveFolder(oldPath, newPath string) *httperrors.Error {
+	oldPrefix := b.ObjectKey(oldPath)
+	objects, err := b.ListObjects(oldPrefix)
+	if err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		if err := b.MoveObject(object.Key, b.ObjectKey(newPath)+strings.TrimPrefix(object.Key, oldPrefix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *bucket) GeneratePresignedUploadURL(fullPath string) (*models.UploadSignedURLResponse, *httperrors.Error) {
+	key := b.ObjectKey(fullPath)
+	req, _ := b.client.PutObjectRequest(&awss3.PutObjectInput{
+		Bucket: aws.String(b.bucketName),
+		Key:    aws.String(b.objectName(key)),
+	})
+
+	signedURL, err := req.Presign(uploadURLExpiry)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &models.UploadSignedURLResponse{URL: signedURL, S3Key: key}, nil
+}
+
+func (b *bucket) GeneratePresignedDownloadURL(key string, opts models.DownloadOptions) (*models.DownloadSignedURLResponse, *httperrors.Error) {
+	input := &awss3.GetObjectInput{
+		Bucket:                     aws.String(b.bucketName),
+		Key:                        aws.String(b.objectName(key)),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("%s; filename=%q", opts.Disposition, opts.FileName)),
+	}
+	if opts.MimeType != "" {
+		input.ResponseContentType = aws.String(opts.MimeType)
+	}
+	req, _ := b.client.GetObjectRequest(input)
+
+	signedURL, err := req.Presign(opts.ExpiresIn)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &models.DownloadSignedURLResponse{
+		URL:         signedURL,
+		ExpiresAt:   time.Now().UTC().Add(opts.ExpiresIn),
+		Disposition: opts.Disposition,
+		FileName:    opts.FileName,
+		MimeType:    opts.MimeType,
+	}, nil
+}
+
+func (b *bucket) CreateMultipartUpload(key string) (string, *httperrors.Error) {
+	output, err := b.client.CreateMultipartUpload(&awss3.CreateMultipartUploadInput{
+		Bucket: aws.String(b.bucketName),
+		Key:    aws.String(b.objectName(key)),
+	})
+	if err != nil {
+		return "", storageError(err)
+	}
+	return aws.StringValue(output.UploadId), nil
+}
+
+func (b *bucket) GeneratePresignedPartURL(key, uploadId string, partNumber int) (*models.UploadSignedURLResponse, *httperrors.Error) {
+	req, _ := b.client.UploadPartRequest(&awss3.UploadPartInput{
+		Bucket:     aws.String(b.bucketName),
+		Key:        aws.String(b.objectName(key)),
+		UploadId:   aws.String(uploadId),
+		PartNumber: aws.Int64(int64(partNumber)),
+	})
+
+	signedURL, err := req.Presign(uploadURLExpiry)
+	if err != nil {
+		return nil, storageError(err)
+	}
+	return &models.UploadSignedURLResponse{URL: signedURL, S3Key: key}, nil
+}
+
+// UploadPart uploads a part from a stream. The SDK needs a seekable body to
+// sign and retry the request, so the part is spooled to a temporary file
+// first. Note that S3 rejects parts under 5 MiB other than the last one.
+func (b *bucket) UploadPart(key, uploadId string, partNumber int, body io.Reader) *httperrors.Error {
+	spool, err := os.CreateTemp("", "part-*")
+	if err != nil {
+		return httperrors.NewServerError()
+	}
+	defer func() {
+		spool.Close()
+		if err := os.Remove(spool.Name()); err != nil {
+			log.Println("failed to remove spooled part", spool.Name(), err)
+		}
+	}()
+
+	if _, err := io.Copy(spool, body); err != nil {
+		return httperrors.New(codes.BadRequest, err.Error())
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return httperrors.NewServerError()
+	}
+
+	_, err = b.client.UploadPart(&awss3.UploadPartInput{
+		Bucket:     aws.String(b.bucketName),
+		Key:        aws.String(b.objectName(key)),
+		UploadId:   aws.String(uploadId),
+		PartNumber: aws.Int64(int64(partNumber)),
+		Body:       spool,
+	})
+	if err != nil {
+		return storageError(err)
+	}
+	return nil
+}
+
+// CompleteMultipartUpload assembles the given parts. The ETags are taken from
+// S3's own list of uploaded parts rather than from the caller, since not every
+// upload flow has them.
+func (b *bucket) CompleteMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error {
+	etags := make(map[int64]*string)
+	err := b.client.ListPartsPages(&awss3.ListPartsInput{
+		Bucket:   aws.String(b.bucketName),
+		Key:      aws.String(b.objectName(key)),
+		UploadId: aws.String(uploadId),
+	}, func(page *awss3.ListPartsOutput, lastPage bool) bool {
+		for _, part := range page.Parts {
+			etags[aws.Int64Value(part.PartNumber)] = part.ETag
+		}
+		return true
+	})
+	if err != nil {
+		return storageError(err)
+	}
+
+	completed := make([]*awss3.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		etag, ok := etags[int64(part.PartNumber)]
+		if !ok {
+			return httperrors.New(codes.Conflict, fmt.Sprintf("Part %d has not been uploaded", part.PartNumber))
+		}
+		completed = append(completed, &awss3.CompletedPart{
+			PartNumber: aws.Int64(int64(part.PartNumber)),
+			ETag:       etag,
+		})
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		return *completed[i].PartNumber < *completed[j].PartNumber
+	})
+
+	_, err = b.client.CompleteMultipartUpload(&awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.bucketName),
+		Key:             aws.String(b.objectName(key)),
+		UploadId:        aws.String(uploadId),
+		MultipartUpload: &awss3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return storageError(err)
+	}
+	return nil
+}
+
+func (b *bucket) AbortMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error {
+	_, err := b.client.AbortMultipartUpload(&awss3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.bucketName),
+		Key:      aws.String(b.objectName(key)),
+		UploadId: aws.String(uploadId),
+	})
+	if err != nil {
+		if httpErr := storageError(err); httpErr.Code != codes.NotFound {
+			return httpErr
+		}
+	}
+	return nil
+}
+
+// storageError maps an SDK error onto the API errors used by the services.
+func storageError(err error) *httperrors.Error {
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case awss3.ErrCodeNoSuchKey, awss3.ErrCodeNoSuchUpload, "NotFound":
+			return httperrors.New(codes.NotFound, "Object not found")
+		}
+	}
+	log.Println("s3 request failed:", err)
+	return httperrors.NewDBError()
+}
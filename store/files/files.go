@@ -1,12 +1,17 @@
 package files
 
 import (
+	"context"
 	"database/sql"
 	"fm/models"
+	"fm/store/pagination"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/syntaxLabz/errors/pkg/codes"
 	"github.com/syntaxLabz/errors/pkg/httperrors"
 )
@@ -19,8 +24,48 @@ func New(db *sql.DB) *store {
 	return &store{db: db}
 }
 
+const fileColumns = `id, name, folder_id, full_path, upload_url, s3_key, size, mime_type, created_at, updated_at, uploaded_by, status, checksum, current_version_id, deleted_at, pending_version_id`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanFile reads a row selected with fileColumns.
+func scanFile(row scanner) (*models.File, error) {
+	var file models.File
+	var checksum sql.NullString
+	err := row.Scan(
+		&file.Id,
+		&file.Name,
+		&file.FolderId,
+		&file.FullPath,
+		&file.UploadURL,
+		&file.S3Key,
+		&file.Size,
+		&file.MimeType,
+		&file.CreatedAt,
+		&file.UpdatedAt,
+		&file.UploadedBy,
+		&file.Status,
+		&checksum,
+		&file.CurrentVersionId,
+		&file.DeletedAt,
+		&file.PendingVersionId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	file.Checksum = checksum.String
+	return &file, nil
+}
+
+// nullFolderId is the folder_id to store for file: NULL for files at the root.
+func nullFolderId(file *models.File) uuid.NullUUID {
+	return uuid.NullUUID{UUID: file.FolderId, Valid: file.FolderId != uuid.Nil}
+}
+
 func (s *store) Create(ctx fiber.Ctx, file *models.File) (*models.File, *httperrors.Error) {
-	query := `INSERT INTO files (id, name, folder_id, full_path, upload_url, s3_key, size, mime_type, created_at, updated_at, uploaded_by) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`
+	query := `INSERT INTO files (` + fileColumns + `) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`
 
 	now := time.Now().UTC()
 	if file.CreatedAt.IsZero() {
@@ -35,7 +80,7 @@ func (s *store) Create(ctx fiber.Ctx, file *models.File) (*models.File, *httperr
 	_, err := s.db.ExecContext(ctx.Context(), query,
 		file.Id,
 		file.Name,
-		file.FolderId,
+		nullFolderId(file),
 		file.FullPath,
 		file.UploadURL,
 		file.S3Key,
@@ -44,69 +89,656 @@ func (s *store) Create(ctx fiber.Ctx, file *models.File) (*models.File, *httperr
 		file.CreatedAt,
 		file.UpdatedAt,
 		file.UploadedBy,
+		file.Status,
+		sql.NullString{String: file.Checksum, Valid: file.Checksum != ""},
+		file.CurrentVersionId,
+		file.DeletedAt,
+		file.PendingVersionId,
 	)
 	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, httperrors.New(codes.Conflict, "File name already exists")
+		}
 		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
 	return file, nil
 }
 
 func (s *store) GetById(ctx fiber.Ctx, id uuid.UUID) (*models.File, *httperrors.Error) {
-	query := `SELECT id, name, folder_id, full_path, upload_url, s3_key, size, mime_type, created_at, updated_at, uploaded_by FROM files WHERE id = $1`
+	query := `SELECT ` + fileColumns + ` FROM files WHERE id = $1 AND deleted_at IS NULL`
 	row := s.db.QueryRowContext(ctx.Context(), query, id)
-	var file models.File
-	err := row.Scan(
-		&file.Id,
-		&file.Name,
-		&file.FolderId,
-		&file.FullPath,
-		&file.UploadURL,
-		&file.S3Key,
-		&file.Size,
-		&file.MimeType,
-		&file.CreatedAt,
-		&file.UpdatedAt,
-		&file.UploadedBy,
-	)
+	file, err := scanFile(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, httperrors.New(codes.NotFound, "File not found")
 		}
 		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
-	return &file, nil
+	return file, nil
+}
+
+// GetByName returns the file called name directly inside folderId.
+func (s *store) GetByName(ctx fiber.Ctx, folderId uuid.UUID, name string) (*models.File, *httperrors.Error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE folder_id IS NOT DISTINCT FROM $1 AND name = $2 AND deleted_at IS NULL`
+	file, err := scanFile(s.db.QueryRowContext(ctx.Context(), query, uuid.NullUUID{UUID: folderId, Valid: folderId != uuid.Nil}, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "File not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return file, nil
+}
+
+// fileSortColumns are the columns behind models.FileSorts.
+var fileSortColumns = map[string]pagination.Column{
+	models.SortName:      {Name: "name", Cast: "text"},
+	models.SortCreatedAt: {Name: "created_at", Cast: "timestamptz"},
+	models.SortUpdatedAt: {Name: "updated_at", Cast: "timestamptz"},
+	models.SortSize:      {Name: "size", Cast: "bigint"},
+}
+
+// GetFiles returns a page of the files of a folder outside the trash. Files
+// whose upload has not been completed are left out unless includePending is
+// set.
+func (s *store) GetFiles(ctx fiber.Ctx, parentFolderId uuid.UUID, includePending bool, opts *models.ListOptions) ([]*models.File, *models.Page, *httperrors.Error) {
+	q := &pagination.Query{}
+	q.Where(`folder_id = ` + q.Arg(parentFolderId))
+	q.Where(`deleted_at IS NULL`)
+	q.Where(`EXISTS (SELECT 1 FROM folders f WHERE f.id = files.folder_id AND f.deleted_at IS NULL)`)
+	if !includePending {
+		q.Where(`status = ` + q.Arg(models.FileStatusUploaded))
+	}
+	if opts.NamePrefix != "" {
+		q.NamePrefix("name", opts.NamePrefix)
+	}
+	if prefix, ok := strings.CutSuffix(opts.MimeType, "/*"); ok {
+		q.NamePrefix("mime_type", prefix+"/")
+	} else if opts.MimeType != "" {
+		q.Where(`mime_type = ` + q.Arg(opts.MimeType))
+	}
+	if opts.UploadedBy != nil {
+		q.Where(`uploaded_by = ` + q.Arg(*opts.UploadedBy))
+	}
+	if opts.CreatedAfter != nil {
+		q.Where(`created_at >= ` + q.Arg(*opts.CreatedAfter))
+	}
+	if opts.CreatedBefore != nil {
+		q.Where(`created_at < ` + q.Arg(*opts.CreatedBefore))
+	}
+	if opts.UpdatedAfter != nil {
+		q.Where(`updated_at >= ` + q.Arg(*opts.UpdatedAfter))
+	}
+	if opts.UpdatedBefore != nil {
+		q.Where(`updated_at < ` + q.Arg(*opts.UpdatedBefore))
+	}
+
+	clause, err := q.Page(opts, fileSortColumns)
+	if err != nil {
+		return nil, nil, httperrors.RequestValidationError(httperrors.InvalidQueryParam("cursor"))
+	}
+
+	rows, err := s.db.QueryContext(ctx.Context(), `SELECT `+fileColumns+` FROM files`+clause, q.Args()...)
+	if err != nil {
+		return nil, nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	files := []*models.File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	page := &models.Page{Sort: models.Sort{Field: opts.Sort, Order: opts.Order}}
+	count, more := pagination.Trim(opts, len(files))
+	files = files[:count]
+	if more {
+		last := files[count-1]
+		page.NextCursor = pagination.NextCursor(opts, fileSortValue(last, opts.Sort), last.Id)
+	}
+	return files, page, nil
+}
+
+// fileSortValue returns the value file is sorted by under sort.
+func fileSortValue(file *models.File, sort string) string {
+	switch sort {
+	case models.SortCreatedAt:
+		return file.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case models.SortUpdatedAt:
+		return file.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case models.SortSize:
+		return strconv.Itoa(file.Size)
+	}
+	return file.Name
+}
+
+// Delete removes the file row inside a transaction and calls removeObject with
+// the deleted row before committing, so the row is only gone once its object is.
+func (s *store) Delete(ctx fiber.Ctx, id uuid.UUID, removeObject func(file *models.File) *httperrors.Error) (*models.File, *httperrors.Error) {
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM files WHERE id = $1 RETURNING ` + fileColumns
+	row := tx.QueryRowContext(ctx.Context(), query, id)
+	file, err := scanFile(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "File not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if removeErr := removeObject(file); removeErr != nil {
+		return nil, removeErr
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return file, nil
+}
+
+func (s *store) GetFilesByFolderIds(ctx fiber.Ctx, folderIds []uuid.UUID) ([]*models.File, *httperrors.Error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE folder_id = ANY($1)`
+	rows, err := s.db.QueryContext(ctx.Context(), query, pq.Array(folderIds))
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return files, nil
+}
+
+// GetTreeFiles returns up to limit uploaded files inside folderIds, and at the
+// root when includeRoot is set. Root files come first, then the files of each
+// folder in the order of folderIds, by name.
+func (s *store) GetTreeFiles(ctx fiber.Ctx, folderIds []uuid.UUID, includeRoot bool, limit int) ([]*models.File, *httperrors.Error) {
+	query := `SELECT ` + fileColumns + ` FROM files
+	WHERE (folder_id = ANY($1) OR ($2 AND folder_id IS NULL)) AND deleted_at IS NULL AND status = $3
+	ORDER BY array_position($1::uuid[], folder_id) NULLS FIRST, name, id
+	LIMIT $4`
+	rows, err := s.db.QueryContext(ctx.Context(), query, pq.Array(folderIds), includeRoot, models.FileStatusUploaded, limit)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		files = append(files, file)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return files, nil
+}
+
+// GetArchiveEntries returns the uploaded files under folderId at any depth,
+// each with its path relative to that folder, ordered by path. Files in the
+// trash, or below a trashed subfolder, are left out.
+func (s *store) GetArchiveEntries(ctx context.Context, folderId uuid.UUID) ([]models.ArchiveEntry, error) {
+	query := `SELECT ` + fileColumns + `, path FROM (
+		SELECT f.*, substr(d.full_path || '/', length(r.full_path) + 2) || f.name AS path
+		FROM files f
+		JOIN folders d ON d.id = f.folder_id
+		JOIN folder_closure c ON c.descendant_id = d.id
+		JOIN folders r ON r.id = c.ancestor_id
+		WHERE c.ancestor_id = $1 AND f.deleted_at IS NULL AND f.status = $2
+		AND NOT EXISTS (
+			SELECT 1 FROM folder_closure b JOIN folders t ON t.id = b.ancestor_id
+			WHERE b.descendant_id = d.id AND b.depth < c.depth AND t.deleted_at IS NOT NULL
+		)
+	) entries
+	ORDER BY path`
+	rows, err := s.db.QueryContext(ctx, query, folderId, models.FileStatusUploaded)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.ArchiveEntry
+	for rows.Next() {
+		var entry models.ArchiveEntry
+		file, err := scanFile(withPath{rows, &entry.Path})
+		if err != nil {
+			return nil, err
+		}
+		entry.File = file
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// withPath scans a trailing path column after the fileColumns.
+type withPath struct {
+	row  scanner
+	path *string
+}
+
+func (r withPath) Scan(dest ...any) error {
+	return r.row.Scan(append(dest, r.path)...)
+}
+
+func (s *store) DeleteByIds(ctx fiber.Ctx, ids []uuid.UUID) *httperrors.Error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `DELETE FROM files WHERE id = ANY($1)`
+	_, err := s.db.ExecContext(ctx.Context(), query, pq.Array(ids))
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return nil
+}
+
+func (s *store) Update(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	query := `UPDATE files SET name = $1, folder_id = $2, full_path = $3, s3_key = $4, updated_at = $5 WHERE id = $6`
+
+	file.UpdatedAt = time.Now().UTC()
+
+	result, err := s.db.ExecContext(ctx.Context(), query,
+		file.Name,
+		nullFolderId(file),
+		file.FullPath,
+		file.S3Key,
+		file.UpdatedAt,
+		file.Id,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return httperrors.New(codes.Conflict, "File name already exists")
+		}
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return httperrors.New(codes.NotFound, "File not found")
+	}
+	return nil
 }
 
-func (s *store) GetFiles(ctx fiber.Ctx, parentFolderId uuid.UUID) ([]*models.File, *httperrors.Error) {
-	query := `SELECT id, name, folder_id, full_path, upload_url, s3_key, size, mime_type, created_at, updated_at, uploaded_by FROM files WHERE folder_id = $1`
-	rows, err := s.db.QueryContext(ctx.Context(), query, parentFolderId)
+// UpdateUploadStatus records the outcome of an upload: status, object key,
+// size, mime type, checksum, uploader and current version.
+func (s *store) UpdateUploadStatus(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	query := `UPDATE files SET status = $1, size = $2, mime_type = $3, updated_at = $4, checksum = $6, uploaded_by = $7, current_version_id = $8, s3_key = $9, pending_version_id = $10 WHERE id = $5`
+
+	file.UpdatedAt = time.Now().UTC()
+
+	result, err := s.db.ExecContext(ctx.Context(), query,
+		file.Status,
+		file.Size,
+		file.MimeType,
+		file.UpdatedAt,
+		file.Id,
+		sql.NullString{String: file.Checksum, Valid: file.Checksum != ""},
+		file.UploadedBy,
+		file.CurrentVersionId,
+		file.S3Key,
+		file.PendingVersionId,
+	)
 	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return httperrors.New(codes.NotFound, "File not found")
+	}
+	return nil
+}
+
+// CreateUploaded inserts file together with version, the content already
+// stored for it, as its current version. Both are written in one transaction,
+// so the name is only claimed once the content is in place, and a file of the
+// same name created in the meantime makes it a conflict.
+func (s *store) CreateUploaded(ctx fiber.Ctx, file *models.File, version *models.FileVersion) (*models.File, *httperrors.Error) {
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	file.CreatedAt = now
+	file.UpdatedAt = now
+	file.CurrentVersionId = nil
+
+	query := `INSERT INTO files (` + fileColumns + `) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)`
+	_, err = tx.ExecContext(ctx.Context(), query,
+		file.Id,
+		file.Name,
+		nullFolderId(file),
+		file.FullPath,
+		file.UploadURL,
+		file.S3Key,
+		file.Size,
+		file.MimeType,
+		file.CreatedAt,
+		file.UpdatedAt,
+		file.UploadedBy,
+		file.Status,
+		sql.NullString{String: file.Checksum, Valid: file.Checksum != ""},
+		file.CurrentVersionId,
+		file.DeletedAt,
+		file.PendingVersionId,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, httperrors.New(codes.Conflict, "File name already exists")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if err := insertVersion(ctx.Context(), tx, version); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if _, err := tx.ExecContext(ctx.Context(), `UPDATE files SET current_version_id = $1 WHERE id = $2`, version.Id, file.Id); err != nil {
 		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	file.CurrentVersionId = &version.Id
+	return file, nil
+}
+
+// AddVersion records version, whose content is already stored, and makes it
+// the current version of file in one transaction. An overwrite staged by
+// someone else stays pending.
+func (s *store) AddVersion(ctx fiber.Ctx, file *models.File, version *models.FileVersion) *httperrors.Error {
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	if err := insertVersion(ctx.Context(), tx, version); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return httperrors.New(codes.Conflict, "Another version of the file is being recorded")
+		}
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	file.Status = models.FileStatusUploaded
+	file.S3Key = version.S3Key
+	file.Size = version.Size
+	file.MimeType = version.MimeType
+	file.Checksum = version.Checksum
+	file.UploadedBy = version.UploadedBy
+	file.CurrentVersionId = &version.Id
+	file.UpdatedAt = time.Now().UTC()
+	result, err := tx.ExecContext(ctx.Context(), `UPDATE files SET status = $1, s3_key = $2, size = $3, mime_type = $4, checksum = $5, uploaded_by = $6, current_version_id = $7, updated_at = $8
+	WHERE id = $9 AND deleted_at IS NULL`,
+		file.Status,
+		file.S3Key,
+		file.Size,
+		file.MimeType,
+		sql.NullString{String: file.Checksum, Valid: file.Checksum != ""},
+		file.UploadedBy,
+		file.CurrentVersionId,
+		file.UpdatedAt,
+		file.Id,
+	)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return httperrors.New(codes.NotFound, "File not found")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return nil
+}
+
+// insertVersion adds version as the next committed version of its file.
+func insertVersion(ctx context.Context, tx *sql.Tx, version *models.FileVersion) error {
+	query := `INSERT INTO file_versions (id, file_id, version_number, s3_key, size, mime_type, checksum, uploaded_by, created_at)
+	VALUES ($1, $2, (SELECT COALESCE(MAX(version_number), 0) + 1 FROM file_versions WHERE file_id = $2), $3, $4, $5, $6, $7, $8)
+	RETURNING version_number`
+
+	if version.Id == uuid.Nil {
+		version.Id = uuid.New()
+	}
+	version.CreatedAt = time.Now().UTC()
+
+	return tx.QueryRowContext(ctx, query,
+		version.Id,
+		version.FileId,
+		version.S3Key,
+		version.Size,
+		version.MimeType,
+		sql.NullString{String: version.Checksum, Valid: version.Checksum != ""},
+		version.UploadedBy,
+		version.CreatedAt,
+	).Scan(&version.VersionNumber)
+}
+
+// StageUpload records the pending version an overwrite of the file uploads
+// to, along with its upload URL. The file keeps its current content until the
+// pending version is committed.
+func (s *store) StageUpload(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	query := `UPDATE files SET pending_version_id = $1, upload_url = $2, updated_at = $3 WHERE id = $4 AND deleted_at IS NULL`
+
+	file.UpdatedAt = time.Now().UTC()
+
+	result, err := s.db.ExecContext(ctx.Context(), query,
+		file.PendingVersionId,
+		file.UploadURL,
+		file.UpdatedAt,
+		file.Id,
+	)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return httperrors.New(codes.NotFound, "File not found")
+	}
+	return nil
+}
+
+// GetStaleUploads returns up to limit files that never completed an upload,
+// or have a staged overwrite, and were last touched before cutoff, oldest
+// first. Files with a version are only stale through their pending version;
+// their current content is kept. A multipart or tus upload that made progress
+// since cutoff keeps its file alive.
+func (s *store) GetStaleUploads(ctx context.Context, cutoff time.Time, limit int) ([]*models.File, error) {
+	query := `SELECT ` + fileColumns + ` FROM files
+	WHERE ((status <> $1 AND current_version_id IS NULL) OR pending_version_id IS NOT NULL) AND updated_at < $2
+		AND NOT EXISTS (SELECT 1 FROM upload_sessions s WHERE s.file_id = files.id AND s.status = $3 AND s.last_activity_at >= $2)
+		AND NOT EXISTS (SELECT 1 FROM tus_uploads t WHERE t.file_id = files.id AND t.last_activity_at >= $2)
+	ORDER BY updated_at LIMIT $4`
+	rows, err := s.db.QueryContext(ctx, query, models.FileStatusUploaded, cutoff, models.UploadSessionActive, limit)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var files []*models.File
 	for rows.Next() {
-		var file models.File
-		if err := rows.Scan(
-			&file.Id,
-			&file.Name,
-			&file.FolderId,
-			&file.FullPath,
-			&file.UploadURL,
-			&file.S3Key,
-			&file.Size,
-			&file.MimeType,
-			&file.CreatedAt,
-			&file.UpdatedAt,
-			&file.UploadedBy,
-		); err != nil {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// DeleteStaleUpload removes a file row that never completed an upload, calling
+// removeObject before committing. It reports false when the row is gone or
+// its upload got completed in the meantime.
+func (s *store) DeleteStaleUpload(ctx context.Context, id uuid.UUID, removeObject func(file *models.File) error) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM files WHERE id = $1 AND status <> $2 AND current_version_id IS NULL RETURNING ` + fileColumns
+	file, err := scanFile(tx.QueryRowContext(ctx, query, id, models.FileStatusUploaded))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := removeObject(file); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Trash moves a file to the trash.
+func (s *store) Trash(ctx fiber.Ctx, id uuid.UUID) (*models.File, *httperrors.Error) {
+	query := `UPDATE files SET deleted_at = $1 WHERE id = $2 AND deleted_at IS NULL RETURNING ` + fileColumns
+	file, err := scanFile(s.db.QueryRowContext(ctx.Context(), query, time.Now().UTC(), id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "File not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return file, nil
+}
+
+// GetTrash lists the files in the trash, most recently trashed first.
+func (s *store) GetTrash(ctx fiber.Ctx) ([]*models.File, *httperrors.Error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	rows, err := s.db.QueryContext(ctx.Context(), query)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	files := []*models.File{}
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
 			return nil, httperrors.New(codes.InternalServerError, err.Error())
 		}
-		files = append(files, &file)
+		files = append(files, file)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
 	return files, nil
 }
+
+func (s *store) GetTrashedById(ctx fiber.Ctx, id uuid.UUID) (*models.File, *httperrors.Error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE id = $1 AND deleted_at IS NOT NULL`
+	file, err := scanFile(s.db.QueryRowContext(ctx.Context(), query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "File not found in trash")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return file, nil
+}
+
+// Restore takes a file out of the trash into file.FolderId, under the path
+// and key set on file.
+func (s *store) Restore(ctx fiber.Ctx, file *models.File) *httperrors.Error {
+	query := `UPDATE files SET deleted_at = NULL, folder_id = $1, full_path = $2, s3_key = $3, updated_at = $4 WHERE id = $5 AND deleted_at IS NOT NULL`
+
+	file.UpdatedAt = time.Now().UTC()
+
+	result, err := s.db.ExecContext(ctx.Context(), query,
+		nullFolderId(file),
+		file.FullPath,
+		file.S3Key,
+		file.UpdatedAt,
+		file.Id,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return httperrors.New(codes.Conflict, "File name already exists")
+		}
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return httperrors.New(codes.NotFound, "File not found in trash")
+	}
+	file.DeletedAt = nil
+	return nil
+}
+
+// GetExpiredTrash returns up to limit files trashed before cutoff, oldest first.
+func (s *store) GetExpiredTrash(ctx context.Context, cutoff time.Time, limit int) ([]*models.File, error) {
+	query := `SELECT ` + fileColumns + ` FROM files WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []*models.File
+	for rows.Next() {
+		file, err := scanFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+// Purge permanently removes a file that is in the trash, calling removeObject
+// before committing. It reports false when the file is no longer in the trash.
+func (s *store) Purge(ctx context.Context, id uuid.UUID, removeObject func(file *models.File) error) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM files WHERE id = $1 AND deleted_at IS NOT NULL RETURNING ` + fileColumns
+	file, err := scanFile(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := removeObject(file); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
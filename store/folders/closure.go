@@ -0,0 +1,105 @@
+package folders
+
+import (
+	"context"
+	"database/sql"
+	"fm/models"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+// The folder_closure table holds a row for every folder and each of its
+// ancestors, the folder itself included at depth 0, so subtree and ancestor
+// queries are a single indexed lookup instead of a walk over parent_id. It is
+// kept in sync by Create and UpdateTree; deletes cascade. It follows the
+// structure only: folders in the trash keep their rows.
+
+// link adds the closure rows of a new folder below parentID, or at the root
+// when parentID is nil.
+func link(ctx context.Context, tx *sql.Tx, id uuid.UUID, parentID *uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, `INSERT INTO folder_closure (ancestor_id, descendant_id, depth)
+	SELECT ancestor_id, $1::uuid, depth + 1 FROM folder_closure WHERE descendant_id = $2
+	UNION ALL
+	SELECT $1::uuid, $1::uuid, 0`, id, parentID)
+	return err
+}
+
+// relink moves the subtree of id below parentID, or to the root when parentID
+// is nil: the rows tying it to its old ancestors are replaced by rows for the
+// new ones.
+func relink(ctx context.Context, tx *sql.Tx, id uuid.UUID, parentID *uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM folder_closure
+	WHERE descendant_id IN (SELECT descendant_id FROM folder_closure WHERE ancestor_id = $1)
+	AND ancestor_id NOT IN (SELECT descendant_id FROM folder_closure WHERE ancestor_id = $1)`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO folder_closure (ancestor_id, descendant_id, depth)
+	SELECT a.ancestor_id, d.descendant_id, a.depth + d.depth + 1
+	FROM folder_closure a CROSS JOIN folder_closure d
+	WHERE a.descendant_id = $2 AND d.ancestor_id = $1`, id, parentID)
+	return err
+}
+
+// lockSubtree locks the rows of the folders below id, so their paths can't
+// change until the transaction ends.
+func lockSubtree(ctx context.Context, tx *sql.Tx, id uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, `SELECT f.id FROM folders f JOIN folder_closure c ON c.descendant_id = f.id
+	WHERE c.ancestor_id = $1 AND c.depth > 0
+	FOR UPDATE OF f`, id)
+	return err
+}
+
+// IsAncestor reports whether ancestorID is a folder above descendantID, at
+// any depth. A folder is not its own ancestor.
+func (s *store) IsAncestor(ctx fiber.Ctx, ancestorID, descendantID uuid.UUID) (bool, *httperrors.Error) {
+	query := `SELECT EXISTS (SELECT 1 FROM folder_closure WHERE ancestor_id = $1 AND descendant_id = $2 AND depth > 0)`
+	var isAncestor bool
+	if err := s.db.QueryRowContext(ctx.Context(), query, ancestorID, descendantID).Scan(&isAncestor); err != nil {
+		return false, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return isAncestor, nil
+}
+
+// Descendants returns every folder below id, shallowest first, including
+// folders in the trash.
+func (s *store) Descendants(ctx fiber.Ctx, id uuid.UUID) ([]models.Folder, *httperrors.Error) {
+	query := `SELECT ` + folderColumns + ` FROM folders f JOIN folder_closure c ON c.descendant_id = f.id
+	WHERE c.ancestor_id = $1 AND c.depth > 0
+	ORDER BY c.depth, f.name, f.id`
+	return s.related(ctx, query, id)
+}
+
+// Ancestors returns every folder above id, starting at the root, including
+// folders in the trash.
+func (s *store) Ancestors(ctx fiber.Ctx, id uuid.UUID) ([]models.Folder, *httperrors.Error) {
+	query := `SELECT ` + folderColumns + ` FROM folders f JOIN folder_closure c ON c.ancestor_id = f.id
+	WHERE c.descendant_id = $1 AND c.depth > 0
+	ORDER BY c.depth DESC`
+	return s.related(ctx, query, id)
+}
+
+func (s *store) related(ctx fiber.Ctx, query string, id uuid.UUID) ([]models.Folder, *httperrors.Error) {
+	rows, err := s.db.QueryContext(ctx.Context(), query, id)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		folders = append(folders, *folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return folders, nil
+}
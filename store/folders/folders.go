@@ -1,12 +1,16 @@
 package folders
 
 import (
+	"context"
 	"database/sql"
 	"fm/models"
+	"fm/store/pagination"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/syntaxLabz/errors/pkg/codes"
 	"github.com/syntaxLabz/errors/pkg/httperrors"
 )
@@ -19,6 +23,35 @@ func New(db *sql.DB) *store {
 	return &store{db: db}
 }
 
+const folderColumns = `id, name, parent_id, owner_id, full_path, created_at, updated_at, deleted_at, file_count, subfolder_count, total_file_count, total_bytes`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanFolder reads a row selected with folderColumns.
+func scanFolder(row scanner) (*models.Folder, error) {
+	var folder models.Folder
+	err := row.Scan(
+		&folder.ID,
+		&folder.Name,
+		&folder.ParentID,
+		&folder.OwnerID,
+		&folder.FullPath,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+		&folder.DeletedAt,
+		&folder.FileCount,
+		&folder.SubfolderCount,
+		&folder.TotalFileCount,
+		&folder.TotalBytes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
 func (s *store) Create(ctx fiber.Ctx, folder *models.Folder) (*models.Folder, *httperrors.Error) {
 	query := `INSERT INTO folders (id, name, parent_id, owner_id, full_path, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
 
@@ -29,7 +62,13 @@ func (s *store) Create(ctx fiber.Ctx, folder *models.Folder) (*models.Folder, *h
 	}
 	folder.UpdatedAt = now
 
-	_, err := s.db.ExecContext(ctx.Context(), query,
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx.Context(), query,
 		folder.ID,
 		folder.Name,
 		folder.ParentID,
@@ -39,43 +78,367 @@ func (s *store) Create(ctx fiber.Ctx, folder *models.Folder) (*models.Folder, *h
 		folder.UpdatedAt,
 	)
 	if err != nil {
-		// Check for unique constraint violation (Postgres and SQLite)
-		if err.Error() != "" && ( // SQLite
-		err.Error() == "UNIQUE constraint failed: folders.name" ||
-			// Postgres
-			err.Error() == "pq: duplicate key value violates unique constraint \"folders_pkey\"") {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
 			return nil, httperrors.New(codes.Conflict, "Folder name already exists")
 		}
 		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
+
+	if err := link(ctx.Context(), tx, folder.ID, folder.ParentID); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return folder, nil
+}
+
+// GetByName returns the folder called name directly inside parentID, or at
+// the root when parentID is nil.
+func (s *store) GetByName(ctx fiber.Ctx, parentID *uuid.UUID, name string) (*models.Folder, *httperrors.Error) {
+	query := `SELECT ` + folderColumns + ` FROM folders WHERE parent_id IS NOT DISTINCT FROM $1 AND name = $2 AND deleted_at IS NULL`
+	folder, err := scanFolder(s.db.QueryRowContext(ctx.Context(), query, parentID, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Folder not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
 	return folder, nil
 }
 
 func (s *store) GetById(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error) {
-	query := `SELECT id, name, parent_id, owner_id, full_path, created_at, updated_at FROM folders WHERE id = $1`
-	row := s.db.QueryRowContext(ctx.Context(), query, &id)
-	var folder models.Folder
-	err := row.Scan(
-		&folder.ID,
-		&folder.Name,
-		&folder.ParentID,
-		&folder.OwnerID,
-		&folder.FullPath,
-		&folder.CreatedAt,
-		&folder.UpdatedAt,
-	)
+	query := `SELECT ` + folderColumns + ` FROM folders WHERE id = $1 AND deleted_at IS NULL`
+	folder, err := scanFolder(s.db.QueryRowContext(ctx.Context(), query, &id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, httperrors.New(codes.NotFound, "Folder not found")
 		}
 		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
-	return &folder, nil
+	return folder, nil
 }
 
-func (s *store) GetALL(ctx fiber.Ctx) ([]models.Folder, *httperrors.Error) {
-	query := `SELECT id, name, parent_id, owner_id, full_path, created_at, updated_at FROM folders`
-	rows, err := s.db.QueryContext(ctx.Context(), query)
+// folderSortColumns are the columns behind models.FolderSorts.
+var folderSortColumns = map[string]pagination.Column{
+	models.SortName:      {Name: "name", Cast: "text"},
+	models.SortCreatedAt: {Name: "created_at", Cast: "timestamptz"},
+	models.SortUpdatedAt: {Name: "updated_at", Cast: "timestamptz"},
+}
+
+// GetALL returns a page of the folders outside the trash, leaving out the
+// contents of trashed folders too.
+func (s *store) GetALL(ctx fiber.Ctx, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error) {
+	query := `WITH RECURSIVE live AS (
+		SELECT id FROM folders WHERE parent_id IS NULL AND deleted_at IS NULL
+		UNION ALL
+		SELECT f.id FROM folders f JOIN live l ON f.parent_id = l.id WHERE f.deleted_at IS NULL
+	)
+	SELECT ` + folderColumns + ` FROM folders JOIN live USING (id)`
+	return s.list(ctx, query, &pagination.Query{}, opts)
+}
+
+// GetSubFolders returns a page of the folders directly inside id.
+func (s *store) GetSubFolders(ctx fiber.Ctx, id *uuid.UUID, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error) {
+	query := `SELECT ` + folderColumns + ` FROM folders`
+	q := &pagination.Query{}
+	q.Where(`parent_id = ` + q.Arg(id))
+	q.Where(`deleted_at IS NULL`)
+	return s.list(ctx, query, q, opts)
+}
+
+// list runs query, which selects folder rows, with the filters and page of opts.
+func (s *store) list(ctx fiber.Ctx, query string, q *pagination.Query, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error) {
+	if opts.NamePrefix != "" {
+		q.NamePrefix("name", opts.NamePrefix)
+	}
+	if opts.CreatedAfter != nil {
+		q.Where(`created_at >= ` + q.Arg(*opts.CreatedAfter))
+	}
+	if opts.CreatedBefore != nil {
+		q.Where(`created_at < ` + q.Arg(*opts.CreatedBefore))
+	}
+	if opts.UpdatedAfter != nil {
+		q.Where(`updated_at >= ` + q.Arg(*opts.UpdatedAfter))
+	}
+	if opts.UpdatedBefore != nil {
+		q.Where(`updated_at < ` + q.Arg(*opts.UpdatedBefore))
+	}
+
+	clause, err := q.Page(opts, folderSortColumns)
+	if err != nil {
+		return nil, nil, httperrors.RequestValidationError(httperrors.InvalidQueryParam("cursor"))
+	}
+
+	rows, err := s.db.QueryContext(ctx.Context(), query+clause, q.Args()...)
+	if err != nil {
+		return nil, nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, nil, httperrors.New("internal_error", err.Error())
+		}
+		folders = append(folders, *folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, httperrors.New("internal_error", err.Error())
+	}
+
+	page := &models.Page{Sort: models.Sort{Field: opts.Sort, Order: opts.Order}}
+	count, more := pagination.Trim(opts, len(folders))
+	folders = folders[:count]
+	if more {
+		last := folders[count-1]
+		page.NextCursor = pagination.NextCursor(opts, folderSortValue(&last, opts.Sort), last.ID)
+	}
+	return folders, page, nil
+}
+
+// folderSortValue returns the value folder is sorted by under sort.
+func folderSortValue(folder *models.Folder, sort string) string {
+	switch sort {
+	case models.SortCreatedAt:
+		return folder.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case models.SortUpdatedAt:
+		return folder.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return folder.Name
+}
+
+// childSortColumns are the columns behind the sorts of GetChildren. Folders
+// sort by size on their total bytes.
+var childSortColumns = map[string]pagination.Column{
+	models.SortName:      {Name: "name", Cast: "text"},
+	models.SortCreatedAt: {Name: "created_at", Cast: "timestamptz"},
+	models.SortUpdatedAt: {Name: "updated_at", Cast: "timestamptz"},
+	models.SortSize:      {Name: "size", Cast: "bigint"},
+}
+
+// Values of the kind column of GetChildren, which puts folders first.
+const (
+	kindFolder = 0
+	kindFile   = 1
+)
+
+// GetChildren returns a page of the folders and files directly inside
+// parentID, or at the root when parentID is nil. Folders come first and carry
+// their item count and total size from the rollups. Files whose upload has not
+// been completed are left out unless includePending is set.
+func (s *store) GetChildren(ctx fiber.Ctx, parentID *uuid.UUID, includePending bool, opts *models.ListOptions) ([]models.Child, *models.Page, *httperrors.Error) {
+	q := &pagination.Query{}
+	folderParent, fileParent := `parent_id IS NULL`, `folder_id IS NULL`
+	if parentID != nil {
+		parent := q.Arg(*parentID)
+		folderParent, fileParent = `parent_id = `+parent, `folder_id = `+parent
+	}
+	query := `SELECT kind, id, name, parent_id, owner_id, full_path, created_at, updated_at, size,
+		upload_url, s3_key, mime_type, status, checksum, current_version_id, file_count, subfolder_count, total_file_count
+	FROM (
+		SELECT ` + strconv.Itoa(kindFolder) + ` AS kind, id, name, parent_id, owner_id, full_path, created_at, updated_at, total_bytes AS size,
+			NULL::text AS upload_url, NULL::text AS s3_key, NULL::text AS mime_type, NULL::text AS status, NULL::text AS checksum, NULL::uuid AS current_version_id,
+			file_count, subfolder_count, total_file_count
+		FROM folders WHERE ` + folderParent + ` AND deleted_at IS NULL
+		UNION ALL
+		SELECT ` + strconv.Itoa(kindFile) + `, id, name, folder_id, uploaded_by, full_path, created_at, updated_at, size,
+			upload_url, s3_key, mime_type, status, checksum, current_version_id, 0, 0, 0
+		FROM files WHERE ` + fileParent + ` AND deleted_at IS NULL AND (` + q.Arg(includePending) + ` OR status = ` + q.Arg(models.FileStatusUploaded) + `)
+	) children`
+
+	if opts.NamePrefix != "" {
+		q.NamePrefix("name", opts.NamePrefix)
+	}
+	if opts.CreatedAfter != nil {
+		q.Where(`created_at >= ` + q.Arg(*opts.CreatedAfter))
+	}
+	if opts.CreatedBefore != nil {
+		q.Where(`created_at < ` + q.Arg(*opts.CreatedBefore))
+	}
+	if opts.UpdatedAfter != nil {
+		q.Where(`updated_at >= ` + q.Arg(*opts.UpdatedAfter))
+	}
+	if opts.UpdatedBefore != nil {
+		q.Where(`updated_at < ` + q.Arg(*opts.UpdatedBefore))
+	}
+
+	clause, err := q.GroupedPage(opts, "kind", childSortColumns)
+	if err != nil {
+		return nil, nil, httperrors.RequestValidationError(httperrors.InvalidQueryParam("cursor"))
+	}
+
+	rows, err := s.db.QueryContext(ctx.Context(), query+clause, q.Args()...)
+	if err != nil {
+		return nil, nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	children := []models.Child{}
+	kinds := []int{}
+	for rows.Next() {
+		var (
+			kind                                         int
+			id, owner                                    uuid.UUID
+			parent                                       uuid.NullUUID
+			name, fullPath                               string
+			createdAt, updatedAt                         time.Time
+			size                                         int64
+			uploadURL, s3Key, mimeType, status, checksum sql.NullString
+			currentVersionId                             *uuid.UUID
+			fileCount, subfolderCount, totalFileCount    int
+		)
+		if err := rows.Scan(&kind, &id, &name, &parent, &owner, &fullPath, &createdAt, &updatedAt, &size,
+			&uploadURL, &s3Key, &mimeType, &status, &checksum, &currentVersionId, &fileCount, &subfolderCount, &totalFileCount); err != nil {
+			return nil, nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+
+		if kind == kindFolder {
+			folder := &models.Folder{
+				ID:             id,
+				Name:           name,
+				OwnerID:        owner,
+				FullPath:       fullPath,
+				CreatedAt:      createdAt,
+				UpdatedAt:      updatedAt,
+				FileCount:      fileCount,
+				SubfolderCount: subfolderCount,
+				TotalFileCount: totalFileCount,
+				TotalBytes:     size,
+			}
+			if parent.Valid {
+				folder.ParentID = &parent.UUID
+			}
+			children = append(children, folderChild(folder))
+		} else {
+			children = append(children, models.Child{Type: models.ChildFile, File: &models.File{
+				Id:               id,
+				Name:             name,
+				FolderId:         parent.UUID,
+				FullPath:         fullPath,
+				UploadURL:        uploadURL.String,
+				S3Key:            s3Key.String,
+				Size:             int(size),
+				MimeType:         mimeType.String,
+				CreatedAt:        createdAt,
+				UpdatedAt:        updatedAt,
+				UploadedBy:       owner,
+				Status:           status.String,
+				Checksum:         checksum.String,
+				CurrentVersionId: currentVersionId,
+			}})
+		}
+		kinds = append(kinds, kind)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	page := &models.Page{Sort: models.Sort{Field: opts.Sort, Order: opts.Order}}
+	count, more := pagination.Trim(opts, len(children))
+	children = children[:count]
+	if more {
+		last := children[count-1]
+		page.NextCursor = pagination.NextGroupedCursor(opts, kinds[count-1], childSortValue(&last, opts.Sort), childId(&last))
+	}
+	return children, page, nil
+}
+
+// childSortValue returns the value child is sorted by under sort.
+func childSortValue(child *models.Child, sort string) string {
+	if child.Folder != nil {
+		if sort == models.SortSize {
+			return strconv.FormatInt(child.Folder.TotalBytes, 10)
+		}
+		return folderSortValue(child.Folder, sort)
+	}
+	switch sort {
+	case models.SortCreatedAt:
+		return child.File.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case models.SortUpdatedAt:
+		return child.File.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	case models.SortSize:
+		return strconv.Itoa(child.File.Size)
+	}
+	return child.File.Name
+}
+
+func childId(child *models.Child) uuid.UUID {
+	if child.Folder != nil {
+		return child.Folder.ID
+	}
+	return child.File.Id
+}
+
+// GetTree returns the live folders from id down, or the whole forest when id
+// is nil, level by level and by name within a level. depth limits the levels
+// below the starting point, with the top-level folders of the forest being
+// level 1; a negative depth doesn't limit them. At most limit folders are
+// returned, and truncated tells whether there were more.
+func (s *store) GetTree(ctx fiber.Ctx, id *uuid.UUID, depth, limit int) ([]models.Child, bool, *httperrors.Error) {
+	start, args := `parent_id IS NULL`, []any{depth, limit + 1}
+	startDepth := 1
+	if id != nil {
+		start, args, startDepth = `id = $3`, append(args, *id), 0
+	}
+
+	// the walk stops at depth, the rollups cover what lies below it
+	query := `WITH RECURSIVE tree AS (
+		SELECT id, ` + strconv.Itoa(startDepth) + ` AS depth FROM folders WHERE ` + start + ` AND deleted_at IS NULL
+		UNION ALL
+		SELECT f.id, t.depth + 1 FROM folders f JOIN tree t ON f.parent_id = t.id
+		WHERE f.deleted_at IS NULL AND ($1 < 0 OR t.depth < $1)
+	)
+	SELECT ` + folderColumns + ` FROM folders JOIN tree USING (id)
+	ORDER BY depth, name, id
+	LIMIT $2`
+	rows, err := s.db.QueryContext(ctx.Context(), query, args...)
+	if err != nil {
+		return nil, false, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	var nodes []models.Child
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, false, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		nodes = append(nodes, folderChild(folder))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if len(nodes) > limit {
+		return nodes[:limit], true, nil
+	}
+	return nodes, false, nil
+}
+
+// folderChild wraps folder as a Child, with the counts taken from its rollups.
+func folderChild(folder *models.Folder) models.Child {
+	items := folder.FileCount + folder.SubfolderCount
+	bytes := folder.TotalBytes
+	return models.Child{Type: models.ChildFolder, Folder: folder, ItemCount: &items, TotalBytes: &bytes}
+}
+
+// WalkPath follows names from the root, one folder per name, and returns the
+// live folders it got through, root first. It stops at the first name without
+// a matching folder, so a shorter result means the path leaves the folders
+// there.
+func (s *store) WalkPath(ctx fiber.Ctx, names []string) ([]models.Folder, *httperrors.Error) {
+	query := `WITH RECURSIVE walk AS (
+		SELECT id, 1 AS depth FROM folders WHERE parent_id IS NULL AND name = ($1::text[])[1] AND deleted_at IS NULL
+		UNION ALL
+		SELECT f.id, w.depth + 1 FROM folders f JOIN walk w ON f.parent_id = w.id
+		WHERE f.name = ($1::text[])[w.depth + 1] AND f.deleted_at IS NULL
+	)
+	SELECT ` + folderColumns + ` FROM folders JOIN walk USING (id)
+	ORDER BY depth`
+	rows, err := s.db.QueryContext(ctx.Context(), query, pq.Array(names))
 	if err != nil {
 		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
@@ -83,52 +446,492 @@ func (s *store) GetALL(ctx fiber.Ctx) ([]models.Folder, *httperrors.Error) {
 
 	var folders []models.Folder
 	for rows.Next() {
-		var folder models.Folder
-		if err := rows.Scan(
-			&folder.ID,
-			&folder.Name,
-			&folder.ParentID,
-			&folder.OwnerID,
-			&folder.FullPath,
-			&folder.CreatedAt,
-			&folder.UpdatedAt,
-		); err != nil {
-			return nil, httperrors.New("internal_error", err.Error())
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
 		}
-		folders = append(folders, folder)
+		folders = append(folders, *folder)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, httperrors.New("internal_error", err.Error())
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
 	return folders, nil
 }
 
-func (s *store) GetSubFolders(ctx fiber.Ctx, id *uuid.UUID) ([]models.Folder, *httperrors.Error) {
-	query := `SELECT id, name, parent_id, owner_id, full_path, created_at, updated_at FROM folders WHERE parent_id = $1`
+// GetBreadcrumbs returns the folders from the root down to id, id included.
+// A folder in the trash, or below one, is not found.
+func (s *store) GetBreadcrumbs(ctx fiber.Ctx, id *uuid.UUID) ([]models.Breadcrumb, *httperrors.Error) {
+	query := `SELECT f.id, f.name, f.full_path, f.deleted_at IS NOT NULL
+	FROM folder_closure c JOIN folders f ON f.id = c.ancestor_id
+	WHERE c.descendant_id = $1
+	ORDER BY c.depth DESC`
 	rows, err := s.db.QueryContext(ctx.Context(), query, id)
 	if err != nil {
 		return nil, httperrors.New(codes.InternalServerError, err.Error())
 	}
 	defer rows.Close()
 
+	var breadcrumbs []models.Breadcrumb
+	for rows.Next() {
+		var breadcrumb models.Breadcrumb
+		var trashed bool
+		if err := rows.Scan(&breadcrumb.ID, &breadcrumb.Name, &breadcrumb.FullPath, &trashed); err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		if trashed {
+			return nil, httperrors.New(codes.NotFound, "Folder not found")
+		}
+		breadcrumbs = append(breadcrumbs, breadcrumb)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	if len(breadcrumbs) == 0 {
+		return nil, httperrors.New(codes.NotFound, "Folder not found")
+	}
+	return breadcrumbs, nil
+}
+
+func (s *store) DeleteByIds(ctx fiber.Ctx, ids []uuid.UUID) *httperrors.Error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	query := `DELETE FROM folders WHERE id = ANY($1)`
+	_, err := s.db.ExecContext(ctx.Context(), query, pq.Array(ids))
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return nil
+}
+
+// UpdateTree persists a rename or move of folder in a single transaction. The
+// rows of the subtree are locked, so the cycle check and the rewritten paths
+// of descendants and files can't race with another change to it. folder's
+// FullPath is derived from the locked parent and filled in, and moveObjects is
+// called with the old and new path before committing.
+func (s *store) UpdateTree(ctx fiber.Ctx, folder *models.Folder, moveObjects func(oldPath, newPath string) *httperrors.Error) *httperrors.Error {
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	var oldParentID *uuid.UUID
+	var oldPath string
+	err = tx.QueryRowContext(ctx.Context(), `SELECT parent_id, full_path FROM folders WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, folder.ID).Scan(&oldParentID, &oldPath)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return httperrors.New(codes.NotFound, "Folder not found")
+		}
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if err := lockSubtree(ctx.Context(), tx, folder.ID); err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	parentPath := ""
+	if folder.ParentID != nil {
+		// a folder can't become a child of itself or of one of its descendants
+		var inSubtree bool
+		err = tx.QueryRowContext(ctx.Context(), `SELECT EXISTS (SELECT 1 FROM folder_closure WHERE ancestor_id = $1 AND descendant_id = $2)`,
+			folder.ID, *folder.ParentID).Scan(&inSubtree)
+		if err != nil {
+			return httperrors.New(codes.InternalServerError, err.Error())
+		}
+		if inSubtree {
+			return httperrors.New(codes.BadRequest, "Folder cannot be moved into its own subtree")
+		}
+
+		err = tx.QueryRowContext(ctx.Context(), `SELECT full_path FROM folders WHERE id = $1 AND deleted_at IS NULL FOR SHARE`, *folder.ParentID).Scan(&parentPath)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return httperrors.New(codes.NotFound, "Folder not found")
+			}
+			return httperrors.New(codes.InternalServerError, err.Error())
+		}
+	}
+
+	folder.FullPath = parentPath + "/" + folder.Name
+	folder.UpdatedAt = time.Now().UTC()
+	_, err = tx.ExecContext(ctx.Context(),
+		`UPDATE folders SET name = $1, parent_id = $2, full_path = $3, updated_at = $4 WHERE id = $5`,
+		folder.Name,
+		folder.ParentID,
+		folder.FullPath,
+		folder.UpdatedAt,
+		folder.ID,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return httperrors.New(codes.Conflict, "Folder name already exists")
+		}
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if !sameParent(oldParentID, folder.ParentID) {
+		if err := relink(ctx.Context(), tx, folder.ID, folder.ParentID); err != nil {
+			return httperrors.New(codes.InternalServerError, err.Error())
+		}
+	}
+
+	if folder.FullPath == oldPath {
+		if err := tx.Commit(); err != nil {
+			return httperrors.New(codes.InternalServerError, err.Error())
+		}
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx.Context(), `UPDATE folders f SET full_path = $1::text || substr(f.full_path, length($2::text) + 1), updated_at = $3
+	FROM folder_closure c
+	WHERE c.descendant_id = f.id AND c.ancestor_id = $4 AND c.depth > 0`,
+		folder.FullPath, oldPath, folder.UpdatedAt, folder.ID)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	// a file's full_path is the bucket name followed by its path, which starts
+	// at the first "/"; s3_key follows it only for objects still kept under
+	// the file's path
+	_, err = tx.ExecContext(ctx.Context(), `UPDATE files fl
+	SET full_path = overlay(fl.full_path PLACING $1::text FROM strpos(fl.full_path, '/') FOR length($2::text)),
+		s3_key = CASE WHEN fl.s3_key = '' OR fl.s3_key = fl.full_path
+			THEN overlay(fl.full_path PLACING $1::text FROM strpos(fl.full_path, '/') FOR length($2::text))
+			ELSE fl.s3_key END,
+		updated_at = $3
+	FROM folder_closure c
+	WHERE c.descendant_id = fl.folder_id AND c.ancestor_id = $4`,
+		folder.FullPath, oldPath, folder.UpdatedAt, folder.ID)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if moveErr := moveObjects(oldPath, folder.FullPath); moveErr != nil {
+		return moveErr
+	}
+
+	if err := tx.Commit(); err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return nil
+}
+
+func sameParent(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Trash moves a folder, and with it everything below, to the trash. The rows
+// of the subtree are locked, files whose object is still kept under their path
+// are pointed at the same place below trashPath, and moveObjects is called to
+// move the objects there before committing, so the path is free for reuse.
+func (s *store) Trash(ctx fiber.Ctx, id *uuid.UUID, trashPath string, moveObjects func(oldPath, newPath string) *httperrors.Error) (*models.Folder, *httperrors.Error) {
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE folders SET deleted_at = $1, trash_path = $2 WHERE id = $3 AND deleted_at IS NULL RETURNING ` + folderColumns
+	folder, err := scanFolder(tx.QueryRowContext(ctx.Context(), query, time.Now().UTC(), trashPath, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Folder not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if err := lockSubtree(ctx.Context(), tx, folder.ID); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	_, err = tx.ExecContext(ctx.Context(), `UPDATE files fl
+	SET s3_key = overlay(fl.full_path PLACING $1::text FROM strpos(fl.full_path, '/') FOR length($2::text))
+	FROM folder_closure c
+	WHERE c.descendant_id = fl.folder_id AND c.ancestor_id = $3 AND (fl.s3_key = '' OR fl.s3_key = fl.full_path)`,
+		trashPath, folder.FullPath, folder.ID)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if moveErr := moveObjects(folder.FullPath, trashPath); moveErr != nil {
+		return nil, moveErr
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return folder, nil
+}
+
+// GetTrash lists the folders in the trash, most recently trashed first.
+func (s *store) GetTrash(ctx fiber.Ctx) ([]models.Folder, *httperrors.Error) {
+	query := `SELECT ` + folderColumns + ` FROM folders WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`
+	rows, err := s.db.QueryContext(ctx.Context(), query)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	folders := []models.Folder{}
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		folders = append(folders, *folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return folders, nil
+}
+
+func (s *store) GetTrashedById(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error) {
+	query := `SELECT ` + folderColumns + ` FROM folders WHERE id = $1 AND deleted_at IS NOT NULL`
+	folder, err := scanFolder(s.db.QueryRowContext(ctx.Context(), query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Folder not found in trash")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return folder, nil
+}
+
+// Restore takes a folder out of the trash. It goes back into its parent, or
+// to the root when the parent is no longer reachable, and the paths below it
+// follow. Its objects are moved once, from where Trash put them straight to
+// that path, with moveObjects before committing, and the files that were kept
+// under their path point there again. A live folder that took the name in the
+// meantime makes it a conflict rather than a merge.
+func (s *store) Restore(ctx fiber.Ctx, id *uuid.UUID, moveObjects func(oldPath, newPath string) *httperrors.Error) (*models.Folder, *httperrors.Error) {
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	var trashPath sql.NullString
+	err = tx.QueryRowContext(ctx.Context(), `SELECT trash_path FROM folders WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE`, id).Scan(&trashPath)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Folder not found in trash")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	folder, err := scanFolder(tx.QueryRowContext(ctx.Context(), `SELECT `+folderColumns+` FROM folders WHERE id = $1`, id))
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	oldParentID, oldPath := folder.ParentID, folder.FullPath
+
+	// folders trashed before trash_path existed kept their objects in place
+	objectsPath := oldPath
+	if trashPath.Valid {
+		objectsPath = trashPath.String
+	}
+
+	if err := lockSubtree(ctx.Context(), tx, folder.ID); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	parentPath := ""
+	if folder.ParentID != nil {
+		var reachable bool
+		err = tx.QueryRowContext(ctx.Context(), `SELECT COUNT(*) > 0 AND bool_and(f.deleted_at IS NULL)
+		FROM folder_closure c JOIN folders f ON f.id = c.ancestor_id
+		WHERE c.descendant_id = $1`, *folder.ParentID).Scan(&reachable)
+		if err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		if reachable {
+			err = tx.QueryRowContext(ctx.Context(), `SELECT full_path FROM folders WHERE id = $1 FOR SHARE`, *folder.ParentID).Scan(&parentPath)
+			if err != nil {
+				return nil, httperrors.New(codes.InternalServerError, err.Error())
+			}
+		} else {
+			folder.ParentID = nil
+		}
+	}
+
+	folder.FullPath = parentPath + "/" + folder.Name
+	folder.DeletedAt = nil
+	folder.UpdatedAt = time.Now().UTC()
+	_, err = tx.ExecContext(ctx.Context(),
+		`UPDATE folders SET deleted_at = NULL, trash_path = NULL, parent_id = $1, full_path = $2, updated_at = $3 WHERE id = $4`,
+		folder.ParentID,
+		folder.FullPath,
+		folder.UpdatedAt,
+		folder.ID,
+	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, httperrors.New(codes.Conflict, "Folder name already exists")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if !sameParent(oldParentID, folder.ParentID) {
+		if err := relink(ctx.Context(), tx, folder.ID, folder.ParentID); err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+	}
+
+	_, err = tx.ExecContext(ctx.Context(), `UPDATE folders f SET full_path = $1::text || substr(f.full_path, length($2::text) + 1), updated_at = $3
+	FROM folder_closure c
+	WHERE c.descendant_id = f.id AND c.ancestor_id = $4 AND c.depth > 0`,
+		folder.FullPath, oldPath, folder.UpdatedAt, folder.ID)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	// the s3_key of a file kept under its path went below objectsPath with the
+	// rest, and follows it to the new path
+	_, err = tx.ExecContext(ctx.Context(), `UPDATE files fl
+	SET full_path = overlay(fl.full_path PLACING $1::text FROM strpos(fl.full_path, '/') FOR length($2::text)),
+		s3_key = CASE WHEN fl.s3_key = '' OR fl.s3_key = overlay(fl.full_path PLACING $3::text FROM strpos(fl.full_path, '/') FOR length($2::text))
+			THEN overlay(fl.full_path PLACING $1::text FROM strpos(fl.full_path, '/') FOR length($2::text))
+			ELSE fl.s3_key END,
+		updated_at = $4
+	FROM folder_closure c
+	WHERE c.descendant_id = fl.folder_id AND c.ancestor_id = $5`,
+		folder.FullPath, oldPath, objectsPath, folder.UpdatedAt, folder.ID)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if objectsPath != folder.FullPath {
+		if moveErr := moveObjects(objectsPath, folder.FullPath); moveErr != nil {
+			return nil, moveErr
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return folder, nil
+}
+
+// InTrash reports whether the folder is unreachable: missing, in the trash,
+// or below a folder in the trash.
+func (s *store) InTrash(ctx fiber.Ctx, id *uuid.UUID) (bool, *httperrors.Error) {
+	query := `SELECT COUNT(*) = 0 OR bool_or(f.deleted_at IS NOT NULL)
+	FROM folder_closure c JOIN folders f ON f.id = c.ancestor_id
+	WHERE c.descendant_id = $1`
+	var inTrash bool
+	if err := s.db.QueryRowContext(ctx.Context(), query, id).Scan(&inTrash); err != nil {
+		return false, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return inTrash, nil
+}
+
+// GetExpiredTrash returns up to limit folders trashed before cutoff, oldest first.
+func (s *store) GetExpiredTrash(ctx context.Context, cutoff time.Time, limit int) ([]models.Folder, error) {
+	query := `SELECT ` + folderColumns + ` FROM folders WHERE deleted_at < $1 ORDER BY deleted_at LIMIT $2`
+	rows, err := s.db.QueryContext(ctx, query, cutoff, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
 	var folders []models.Folder
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, *folder)
+	}
+	return folders, rows.Err()
+}
+
+// PurgeTree permanently removes a folder that is in the trash together with
+// everything below it. removeObjects gets the trash_path of every folder of
+// the subtree that was trashed on its own, the folder's first, none for
+// folders trashed with their objects left in place, the folders of the
+// subtree, with only their id and full_path, and the id and keys of their
+// files; it is called before committing. It reports false when the folder is
+// no longer in the trash.
+func (s *store) PurgeTree(ctx context.Context, id uuid.UUID, removeObjects func(trashPaths []string, folders []models.Folder, files []*models.File) error) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var inTrash bool
+	err = tx.QueryRowContext(ctx, `SELECT true FROM folders WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE`, id).Scan(&inTrash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT f.id, f.full_path, f.trash_path
+	FROM folders f JOIN folder_closure c ON c.descendant_id = f.id
+	WHERE c.ancestor_id = $1
+	ORDER BY c.depth`, id)
+	if err != nil {
+		return false, err
+	}
+	var folders []models.Folder
+	var folderIds []uuid.UUID
+	var trashPaths []string
 	for rows.Next() {
 		var folder models.Folder
-		if err := rows.Scan(
-			&folder.ID,
-			&folder.Name,
-			&folder.ParentID,
-			&folder.OwnerID,
-			&folder.FullPath,
-			&folder.CreatedAt,
-			&folder.UpdatedAt,
-		); err != nil {
-			return nil, httperrors.New("internal_error", err.Error())
+		var trashPath sql.NullString
+		if err := rows.Scan(&folder.ID, &folder.FullPath, &trashPath); err != nil {
+			rows.Close()
+			return false, err
 		}
 		folders = append(folders, folder)
+		folderIds = append(folderIds, folder.ID)
+		if trashPath.Valid {
+			trashPaths = append(trashPaths, trashPath.String)
+		}
 	}
+	rows.Close()
 	if err := rows.Err(); err != nil {
-		return nil, httperrors.New("internal_error", err.Error())
+		return false, err
 	}
-	return folders, nil
+
+	rows, err = tx.QueryContext(ctx, `SELECT id, full_path, s3_key FROM files WHERE folder_id = ANY($1)`, pq.Array(folderIds))
+	if err != nil {
+		return false, err
+	}
+	var files []*models.File
+	for rows.Next() {
+		var file models.File
+		var key sql.NullString
+		if err := rows.Scan(&file.Id, &file.FullPath, &key); err != nil {
+			rows.Close()
+			return false, err
+		}
+		file.S3Key = key.String
+		files = append(files, &file)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+
+	if err := removeObjects(trashPaths, folders, files); err != nil {
+		return false, err
+	}
+
+	// files and subfolders go along through ON DELETE CASCADE
+	if _, err := tx.ExecContext(ctx, `DELETE FROM folders WHERE id = $1`, id); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
 }
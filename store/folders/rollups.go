@@ -0,0 +1,36 @@
+package folders
+
+import (
+	"context"
+)
+
+// The rollup columns on folders (file_count, subfolder_count,
+// total_file_count, total_bytes) are maintained by triggers on the files and
+// folders tables, so every write path keeps them current. Only uploaded files
+// outside the trash are counted; a trashed folder keeps the totals of its
+// contents but stops counting towards its ancestors until it is restored.
+
+// ReconcileRollups recomputes the rollups of every folder from the files and
+// folders tables and returns how many folders had drifted. Writes to both
+// tables are blocked while it runs so the recount is consistent.
+func (s *store) ReconcileRollups(ctx context.Context) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE folders, files IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return 0, err
+	}
+
+	var fixed int64
+	if err := tx.QueryRowContext(ctx, `SELECT reconcile_folder_rollups()`).Scan(&fixed); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return fixed, nil
+}
@@ -1,7 +1,11 @@
 package store
 
 import (
+	"context"
 	"fm/models"
+	"io"
+	"net/url"
+	"time"
 
 	"github.com/gofiber/fiber/v3"
 	"github.com/google/uuid"
@@ -10,18 +14,135 @@ import (
 
 type Folder interface {
 	Create(ctx fiber.Ctx, folder *models.Folder) (*models.Folder, *httperrors.Error)
-	GetALL(ctx fiber.Ctx) ([]models.Folder, *httperrors.Error)
+	GetALL(ctx fiber.Ctx, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error)
 	GetById(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error)
-	GetSubFolders(ctx fiber.Ctx, id *uuid.UUID) ([]models.Folder, *httperrors.Error)
+	GetByName(ctx fiber.Ctx, parentID *uuid.UUID, name string) (*models.Folder, *httperrors.Error)
+	GetSubFolders(ctx fiber.Ctx, id *uuid.UUID, opts *models.ListOptions) ([]models.Folder, *models.Page, *httperrors.Error)
+	GetChildren(ctx fiber.Ctx, parentID *uuid.UUID, includePending bool, opts *models.ListOptions) ([]models.Child, *models.Page, *httperrors.Error)
+	GetTree(ctx fiber.Ctx, id *uuid.UUID, depth, limit int) ([]models.Child, bool, *httperrors.Error)
+	WalkPath(ctx fiber.Ctx, names []string) ([]models.Folder, *httperrors.Error)
+	GetBreadcrumbs(ctx fiber.Ctx, id *uuid.UUID) ([]models.Breadcrumb, *httperrors.Error)
+	DeleteByIds(ctx fiber.Ctx, ids []uuid.UUID) *httperrors.Error
+	UpdateTree(ctx fiber.Ctx, folder *models.Folder, moveObjects func(oldPath, newPath string) *httperrors.Error) *httperrors.Error
+
+	// hierarchy
+	IsAncestor(ctx fiber.Ctx, ancestorID, descendantID uuid.UUID) (bool, *httperrors.Error)
+	Descendants(ctx fiber.Ctx, id uuid.UUID) ([]models.Folder, *httperrors.Error)
+	Ancestors(ctx fiber.Ctx, id uuid.UUID) ([]models.Folder, *httperrors.Error)
+
+	// rollups
+	ReconcileRollups(ctx context.Context) (int64, error)
+
+	// trash
+	Trash(ctx fiber.Ctx, id *uuid.UUID, trashPath string, moveObjects func(oldPath, newPath string) *httperrors.Error) (*models.Folder, *httperrors.Error)
+	GetTrash(ctx fiber.Ctx) ([]models.Folder, *httperrors.Error)
+	GetTrashedById(ctx fiber.Ctx, id *uuid.UUID) (*models.Folder, *httperrors.Error)
+	Restore(ctx fiber.Ctx, id *uuid.UUID, moveObjects func(oldPath, newPath string) *httperrors.Error) (*models.Folder, *httperrors.Error)
+	InTrash(ctx fiber.Ctx, id *uuid.UUID) (bool, *httperrors.Error)
+	GetExpiredTrash(ctx context.Context, cutoff time.Time, limit int) ([]models.Folder, error)
+	PurgeTree(ctx context.Context, id uuid.UUID, removeObjects func(trashPaths []string, folders []models.Folder, files []*models.File) error) (bool, error)
 }
 
 type File interface {
 	Create(ctx fiber.Ctx, file *models.File) (*models.File, *httperrors.Error)
-	GetFiles(ctx fiber.Ctx, parentFolderId uuid.UUID) ([]*models.File, *httperrors.Error)
+	GetFiles(ctx fiber.Ctx, parentFolderId uuid.UUID, includePending bool, opts *models.ListOptions) ([]*models.File, *models.Page, *httperrors.Error)
 	GetById(ctx fiber.Ctx, id uuid.UUID) (*models.File, *httperrors.Error)
+	GetByName(ctx fiber.Ctx, folderId uuid.UUID, name string) (*models.File, *httperrors.Error)
+	Delete(ctx fiber.Ctx, id uuid.UUID, removeObject func(file *models.File) *httperrors.Error) (*models.File, *httperrors.Error)
+	GetFilesByFolderIds(ctx fiber.Ctx, folderIds []uuid.UUID) ([]*models.File, *httperrors.Error)
+	GetTreeFiles(ctx fiber.Ctx, folderIds []uuid.UUID, includeRoot bool, limit int) ([]*models.File, *httperrors.Error)
+	DeleteByIds(ctx fiber.Ctx, ids []uuid.UUID) *httperrors.Error
+	Update(ctx fiber.Ctx, file *models.File) *httperrors.Error
+	UpdateUploadStatus(ctx fiber.Ctx, file *models.File) *httperrors.Error
+	CreateUploaded(ctx fiber.Ctx, file *models.File, version *models.FileVersion) (*models.File, *httperrors.Error)
+	AddVersion(ctx fiber.Ctx, file *models.File, version *models.FileVersion) *httperrors.Error
+	StageUpload(ctx fiber.Ctx, file *models.File) *httperrors.Error
+	GetStaleUploads(ctx context.Context, cutoff time.Time, limit int) ([]*models.File, error)
+	DeleteStaleUpload(ctx context.Context, id uuid.UUID, removeObject func(file *models.File) error) (bool, error)
+	GetArchiveEntries(ctx context.Context, folderId uuid.UUID) ([]models.ArchiveEntry, error)
+
+	// trash
+	Trash(ctx fiber.Ctx, id uuid.UUID) (*models.File, *httperrors.Error)
+	GetTrash(ctx fiber.Ctx) ([]*models.File, *httperrors.Error)
+	GetTrashedById(ctx fiber.Ctx, id uuid.UUID) (*models.File, *httperrors.Error)
+	Restore(ctx fiber.Ctx, file *models.File) *httperrors.Error
+	GetExpiredTrash(ctx context.Context, cutoff time.Time, limit int) ([]*models.File, error)
+	Purge(ctx context.Context, id uuid.UUID, removeObject func(file *models.File) error) (bool, error)
 }
 
+type FileVersion interface {
+	Create(ctx fiber.Ctx, version *models.FileVersion) (*models.FileVersion, *httperrors.Error)
+	Stage(ctx fiber.Ctx, version *models.FileVersion) (*models.FileVersion, *httperrors.Error)
+	GetPending(ctx fiber.Ctx, id uuid.UUID) (*models.FileVersion, *httperrors.Error)
+	Commit(ctx fiber.Ctx, version *models.FileVersion) (*models.FileVersion, *httperrors.Error)
+	DeletePending(ctx context.Context, id uuid.UUID, removeObject func(version *models.FileVersion) error) (bool, error)
+	GetById(ctx fiber.Ctx, id uuid.UUID) (*models.FileVersion, *httperrors.Error)
+	GetByFileIds(ctx fiber.Ctx, fileIds []uuid.UUID) ([]models.FileVersion, *httperrors.Error)
+	GetKeysByFileIds(ctx context.Context, fileIds []uuid.UUID) ([]string, error)
+	Delete(ctx fiber.Ctx, id uuid.UUID, removeObject func(version *models.FileVersion) *httperrors.Error) (*models.FileVersion, *httperrors.Error)
+}
+
+// Bucket is the storage provider interface. Objects are addressed by S3Key:
+// the bucket name followed by the object's path, as returned by ObjectKey.
+// Implementations live under store/buckets and are picked with STORAGE_DRIVER.
 type Bucket interface {
+	ObjectKey(fullPath string) string
+
+	// objects
+	PutObject(key string, body io.Reader, contentType string) *httperrors.Error
+	GetObject(key string, offset, length int64) (io.ReadCloser, *httperrors.Error)
+	GetObjectInfo(key string) (*models.ObjectInfo, *httperrors.Error)
+	DeleteObject(key string) *httperrors.Error
+	CopyObject(sourceKey, destinationKey string) *httperrors.Error
+	MoveObject(sourceKey, destinationKey string) *httperrors.Error
+	ListObjects(prefix string) ([]models.ObjectInfo, *httperrors.Error)
+
+	// folder markers
 	CreateFolder(fullPath string) (*models.CreateObjectResponse, *httperrors.Error)
+	DeleteFolder(fullPath string) *httperrors.Error
+	MoveFolder(oldPath, newPath string) *httperrors.Error
+
+	// presigned URLs
 	GeneratePresignedUploadURL(fullPath string) (*models.UploadSignedURLResponse, *httperrors.Error)
+	GeneratePresignedDownloadURL(key string, opts models.DownloadOptions) (*models.DownloadSignedURLResponse, *httperrors.Error)
+
+	// multipart uploads
+	CreateMultipartUpload(key string) (string, *httperrors.Error)
+	GeneratePresignedPartURL(key, uploadId string, partNumber int) (*models.UploadSignedURLResponse, *httperrors.Error)
+	UploadPart(key, uploadId string, partNumber int, body io.Reader) *httperrors.Error
+	CompleteMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error
+	AbortMultipartUpload(key, uploadId string, parts []models.UploadPart) *httperrors.Error
+}
+
+// SignedURLServer is implemented by storage drivers that serve their own
+// presigned URLs, such as the local driver. main mounts it under /storage.
+type SignedURLServer interface {
+	ServeUpload(key string, params url.Values, body io.Reader) *httperrors.Error
+	ServeDownload(key string, params url.Values) (io.ReadCloser, map[string]string, *httperrors.Error)
+}
+
+type UploadSession interface {
+	Create(ctx fiber.Ctx, session *models.UploadSession) (*models.UploadSession, *httperrors.Error)
+	GetById(ctx fiber.Ctx, id uuid.UUID) (*models.UploadSession, *httperrors.Error)
+	SavePart(ctx fiber.Ctx, sessionId uuid.UUID, part *models.UploadPart) *httperrors.Error
+	UpdateStatus(ctx fiber.Ctx, session *models.UploadSession) *httperrors.Error
+	AbortByKey(ctx context.Context, fileId uuid.UUID, key string, abort func(session *models.UploadSession) error) error
+}
+
+type TusUpload interface {
+	Create(ctx fiber.Ctx, upload *models.TusUpload) (*models.TusUpload, *httperrors.Error)
+	GetById(ctx fiber.Ctx, id uuid.UUID) (*models.TusUpload, *httperrors.Error)
+	DeleteByKey(ctx context.Context, fileId uuid.UUID, key string, discard func(upload *models.TusUpload) error) error
+	Write(ctx fiber.Ctx, id uuid.UUID, write func(upload *models.TusUpload) *httperrors.Error) (*models.TusUpload, *httperrors.Error)
+	Delete(ctx fiber.Ctx, id uuid.UUID) *httperrors.Error
+}
+
+type ArchiveJob interface {
+	Create(ctx fiber.Ctx, job *models.ArchiveJob) (*models.ArchiveJob, *httperrors.Error)
+	GetById(ctx fiber.Ctx, id uuid.UUID) (*models.ArchiveJob, *httperrors.Error)
+	Claim(ctx context.Context, staleBefore time.Time) (*models.ArchiveJob, error)
+	SaveProgress(ctx context.Context, job *models.ArchiveJob) (bool, error)
+	Finish(ctx context.Context, job *models.ArchiveJob) (bool, error)
+	Release(ctx context.Context, job *models.ArchiveJob) error
+	DeleteExpired(ctx context.Context, finishedBefore time.Time, limit int, removeObject func(job *models.ArchiveJob) error) (int, error)
 }
@@ -0,0 +1,156 @@
+// Package pagination builds keyset paginated listing queries. Rows are
+// ordered by the sort column and then by id, and a cursor carries both values
+// of the last row of a page, so the next page starts right after it no matter
+// how many rows came before.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fm/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Column is the column behind a sort field. Cast is the type cursor values
+// are compared as, since they travel as text.
+type Column struct {
+	Name string
+	Cast string
+}
+
+type cursor struct {
+	Sort  string    `json:"s"`
+	Order string    `json:"o"`
+	Group *int      `json:"g,omitempty"`
+	Value string    `json:"v"`
+	ID    uuid.UUID `json:"id"`
+}
+
+// Query collects the conditions and arguments of a listing query.
+type Query struct {
+	conditions []string
+	args       []any
+}
+
+// Arg adds an argument and returns its placeholder.
+func (q *Query) Arg(value any) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// Where adds a condition; conditions are joined with AND.
+func (q *Query) Where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+func (q *Query) Args() []any {
+	return q.args
+}
+
+// NamePrefix restricts column to values starting with prefix.
+func (q *Query) NamePrefix(column, prefix string) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	q.Where(column + ` LIKE ` + q.Arg(escaped+"%"))
+}
+
+// Page returns the WHERE, ORDER BY and LIMIT clauses for the page of opts.
+// One row more than the limit is selected, which tells whether a next page
+// exists; see Trim. opts.Sort must be a key of columns.
+func (q *Query) Page(opts *models.ListOptions, columns map[string]Column) (string, error) {
+	return q.page(opts, "", columns)
+}
+
+// GroupedPage is Page for listings split into groups by the integer column
+// group. Groups always come in ascending order, whatever opts.Order is, and
+// the rows of each group are sorted by opts.Sort.
+func (q *Query) GroupedPage(opts *models.ListOptions, group string, columns map[string]Column) (string, error) {
+	return q.page(opts, group, columns)
+}
+
+func (q *Query) page(opts *models.ListOptions, group string, columns map[string]Column) (string, error) {
+	column := columns[opts.Sort]
+	direction, compare := "ASC", ">"
+	if opts.Order == models.OrderDesc {
+		direction, compare = "DESC", "<"
+	}
+
+	if opts.Cursor != "" {
+		after, err := decode(opts.Cursor)
+		if err != nil || after.Sort != opts.Sort || after.Order != opts.Order || (after.Group != nil) != (group != "") || !valid(after.Value, column.Cast) {
+			return "", ErrInvalidCursor
+		}
+		keyset := "(" + column.Name + ", id) " + compare + " (" + q.Arg(after.Value) + "::" + column.Cast + ", " + q.Arg(after.ID) + ")"
+		if group != "" {
+			groupArg := q.Arg(*after.Group)
+			keyset = "(" + group + " > " + groupArg + " OR (" + group + " = " + groupArg + " AND " + keyset + "))"
+		}
+		q.Where(keyset)
+	}
+
+	var clause string
+	if len(q.conditions) > 0 {
+		clause = " WHERE " + strings.Join(q.conditions, " AND ")
+	}
+	clause += " ORDER BY "
+	if group != "" {
+		clause += group + " ASC, "
+	}
+	clause += column.Name + " " + direction + ", id " + direction
+	clause += " LIMIT " + q.Arg(opts.Limit+1)
+	return clause, nil
+}
+
+// Trim reports how many of the count selected rows belong to the page and
+// whether there is a next page after them.
+func Trim(opts *models.ListOptions, count int) (int, bool) {
+	if count > opts.Limit {
+		return opts.Limit, true
+	}
+	return count, false
+}
+
+// NextCursor returns the cursor continuing after the row with the given sort
+// value and id.
+func NextCursor(opts *models.ListOptions, value string, id uuid.UUID) string {
+	encoded, _ := json.Marshal(cursor{Sort: opts.Sort, Order: opts.Order, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+// valid reports whether value can be cast to the column type, so a tampered
+// cursor is rejected instead of failing the query.
+func valid(value, cast string) bool {
+	switch cast {
+	case "timestamptz":
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case "bigint":
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	}
+	return true
+}
+
+// NextGroupedCursor is NextCursor for a GroupedPage listing.
+func NextGroupedCursor(opts *models.ListOptions, group int, value string, id uuid.UUID) string {
+	encoded, _ := json.Marshal(cursor{Sort: opts.Sort, Order: opts.Order, Group: &group, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decode(value string) (*cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var c cursor
+	if err := json.Unmarshal(decoded, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
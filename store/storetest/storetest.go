@@ -0,0 +1,86 @@
+// Package storetest gives tests a database migrated like the service's own.
+package storetest
+
+import (
+	"database/sql"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// DB connects to the Postgres database named by the TEST_DATABASE_URL
+// environment variable, a postgres:// URL, and applies the migrations to a
+// schema of the test's own, which is dropped when the test ends. The test is
+// skipped when the variable is not set.
+func DB(t testing.TB) *sql.DB {
+	t.Helper()
+
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	admin, err := sql.Open("postgres", databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal("creating the test schema failed:", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Log("dropping the test schema failed:", err)
+		}
+	})
+
+	schemaURL, err := withSearchPath(databaseURL, schema)
+	if err != nil {
+		t.Fatal("TEST_DATABASE_URL is not a URL:", err)
+	}
+
+	m, err := migrate.New("file://"+migrationsDir(), schemaURL)
+	if err != nil {
+		t.Fatal("migration setup failed:", err)
+	}
+	if err := m.Up(); err != nil {
+		t.Fatal("migration failed:", err)
+	}
+	m.Close()
+
+	db, err := sql.Open("postgres", schemaURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// withSearchPath points every connection made with databaseURL at schema.
+func withSearchPath(databaseURL, schema string) (string, error) {
+	u, err := url.Parse(databaseURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// migrationsDir is the migrations directory at the root of the module.
+func migrationsDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "migrations")
+}
@@ -0,0 +1,186 @@
+package tus
+
+import (
+	"context"
+	"database/sql"
+	"fm/models"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+type store struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *store {
+	return &store{db: db}
+}
+
+func (s *store) Create(ctx fiber.Ctx, upload *models.TusUpload) (*models.TusUpload, *httperrors.Error) {
+	query := `INSERT INTO tus_uploads (id, file_id, upload_id, s3_key, upload_length, upload_offset, part_count, tail_size, metadata, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	now := time.Now().UTC()
+	upload.CreatedAt = now
+	upload.UpdatedAt = now
+
+	if upload.Id == uuid.Nil {
+		upload.Id = uuid.New()
+	}
+
+	_, err := s.db.ExecContext(ctx.Context(), query,
+		upload.Id,
+		upload.FileId,
+		upload.UploadId,
+		upload.S3Key,
+		upload.Length,
+		upload.Offset,
+		upload.PartCount,
+		upload.TailSize,
+		upload.Metadata,
+		upload.CreatedAt,
+		upload.UpdatedAt,
+	)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return upload, nil
+}
+
+const uploadColumns = `id, file_id, upload_id, s3_key, upload_length, upload_offset, part_count, tail_size, metadata, created_at, updated_at`
+
+func scanUpload(row *sql.Row) (*models.TusUpload, error) {
+	var upload models.TusUpload
+	var metadata sql.NullString
+	err := row.Scan(
+		&upload.Id,
+		&upload.FileId,
+		&upload.UploadId,
+		&upload.S3Key,
+		&upload.Length,
+		&upload.Offset,
+		&upload.PartCount,
+		&upload.TailSize,
+		&metadata,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	upload.Metadata = metadata.String
+	return &upload, nil
+}
+
+func (s *store) GetById(ctx fiber.Ctx, id uuid.UUID) (*models.TusUpload, *httperrors.Error) {
+	query := `SELECT ` + uploadColumns + ` FROM tus_uploads WHERE id = $1`
+	upload, err := scanUpload(s.db.QueryRowContext(ctx.Context(), query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Upload not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return upload, nil
+}
+
+// DeleteByKey removes the uploads of file fileId that write to key, calling
+// discard with each of them before its row goes.
+func (s *store) DeleteByKey(ctx context.Context, fileId uuid.UUID, key string, discard func(upload *models.TusUpload) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM tus_uploads WHERE file_id = $1 AND s3_key = $2 FOR UPDATE`, fileId, key)
+	if err != nil {
+		return err
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		upload, err := scanUpload(tx.QueryRowContext(ctx, `SELECT `+uploadColumns+` FROM tus_uploads WHERE id = $1`, id))
+		if err != nil {
+			return err
+		}
+		if err := discard(upload); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM tus_uploads WHERE id = $1`, id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Write locks the row of upload id and calls write with it, which stages a
+// chunk and updates the upload to match, then saves the new offset, part
+// count and tail size. The lock is held until write returns, so a concurrent
+// PATCH, from any instance, fails with a conflict instead of waiting.
+func (s *store) Write(ctx fiber.Ctx, id uuid.UUID, write func(upload *models.TusUpload) *httperrors.Error) (*models.TusUpload, *httperrors.Error) {
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + uploadColumns + ` FROM tus_uploads WHERE id = $1 FOR UPDATE NOWAIT`
+	upload, err := scanUpload(tx.QueryRowContext(ctx.Context(), query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Upload not found")
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "55P03" {
+			return nil, httperrors.New(codes.Conflict, "Upload is already being written")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if err := write(upload); err != nil {
+		return nil, err
+	}
+
+	upload.UpdatedAt = time.Now().UTC()
+	_, err = tx.ExecContext(ctx.Context(), `UPDATE tus_uploads SET upload_offset = $1, part_count = $2, tail_size = $3, updated_at = $4, last_activity_at = $4 WHERE id = $5`,
+		upload.Offset,
+		upload.PartCount,
+		upload.TailSize,
+		upload.UpdatedAt,
+		upload.Id,
+	)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return upload, nil
+}
+
+func (s *store) Delete(ctx fiber.Ctx, id uuid.UUID) *httperrors.Error {
+	query := `DELETE FROM tus_uploads WHERE id = $1`
+	_, err := s.db.ExecContext(ctx.Context(), query, id)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return nil
+}
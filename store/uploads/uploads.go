@@ -0,0 +1,208 @@
+package uploads
+
+import (
+	"context"
+	"database/sql"
+	"fm/models"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+type store struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *store {
+	return &store{db: db}
+}
+
+func (s *store) Create(ctx fiber.Ctx, session *models.UploadSession) (*models.UploadSession, *httperrors.Error) {
+	query := `INSERT INTO upload_sessions (id, file_id, upload_id, s3_key, total_size, part_size, part_count, status, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+
+	now := time.Now().UTC()
+	session.CreatedAt = now
+	session.UpdatedAt = now
+
+	if session.Id == uuid.Nil {
+		session.Id = uuid.New()
+	}
+
+	_, err := s.db.ExecContext(ctx.Context(), query,
+		session.Id,
+		session.FileId,
+		session.UploadId,
+		session.S3Key,
+		session.TotalSize,
+		session.PartSize,
+		session.PartCount,
+		session.Status,
+		session.CreatedAt,
+		session.UpdatedAt,
+	)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	session.Parts = []models.UploadPart{}
+	return session, nil
+}
+
+// GetById returns the session together with the parts completed so far,
+// ordered by part number.
+func (s *store) GetById(ctx fiber.Ctx, id uuid.UUID) (*models.UploadSession, *httperrors.Error) {
+	query := `SELECT id, file_id, upload_id, s3_key, total_size, part_size, part_count, status, created_at, updated_at FROM upload_sessions WHERE id = $1`
+	row := s.db.QueryRowContext(ctx.Context(), query, id)
+	var session models.UploadSession
+	err := row.Scan(
+		&session.Id,
+		&session.FileId,
+		&session.UploadId,
+		&session.S3Key,
+		&session.TotalSize,
+		&session.PartSize,
+		&session.PartCount,
+		&session.Status,
+		&session.CreatedAt,
+		&session.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Upload session not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	session.Parts, err = parts(ctx.Context(), s.db, id)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return &session, nil
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// parts returns the parts completed so far of session id, ordered by part
+// number.
+func parts(ctx context.Context, db queryer, id uuid.UUID) ([]models.UploadPart, error) {
+	query := `SELECT part_number, etag, size, created_at FROM upload_parts WHERE session_id = $1 ORDER BY part_number`
+	rows, err := db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	completed := []models.UploadPart{}
+	for rows.Next() {
+		var part models.UploadPart
+		if err := rows.Scan(
+			&part.PartNumber,
+			&part.ETag,
+			&part.Size,
+			&part.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		completed = append(completed, part)
+	}
+	return completed, rows.Err()
+}
+
+// SavePart records a completed part. Reporting the same part again replaces
+// the earlier record, since clients retry parts that failed half way. The
+// session's activity is recorded too, so an upload that keeps making progress
+// is never taken for abandoned.
+func (s *store) SavePart(ctx fiber.Ctx, sessionId uuid.UUID, part *models.UploadPart) *httperrors.Error {
+	query := `INSERT INTO upload_parts (session_id, part_number, etag, size, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (session_id, part_number) DO UPDATE SET etag = EXCLUDED.etag, size = EXCLUDED.size, created_at = EXCLUDED.created_at`
+
+	part.CreatedAt = time.Now().UTC()
+
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx.Context(), query,
+		sessionId,
+		part.PartNumber,
+		part.ETag,
+		part.Size,
+		part.CreatedAt,
+	)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	_, err = tx.ExecContext(ctx.Context(), `UPDATE upload_sessions SET last_activity_at = $1 WHERE id = $2`, part.CreatedAt, sessionId)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return nil
+}
+
+func (s *store) UpdateStatus(ctx fiber.Ctx, session *models.UploadSession) *httperrors.Error {
+	query := `UPDATE upload_sessions SET status = $1, updated_at = $2 WHERE id = $3`
+
+	session.UpdatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx.Context(), query, session.Status, session.UpdatedAt, session.Id)
+	if err != nil {
+		return httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return nil
+}
+
+// AbortByKey aborts the active sessions of file fileId that upload to key,
+// calling abort with each of them, parts included, before marking it aborted.
+func (s *store) AbortByKey(ctx context.Context, fileId uuid.UUID, key string, abort func(session *models.UploadSession) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, upload_id, s3_key FROM upload_sessions WHERE file_id = $1 AND s3_key = $2 AND status = $3 FOR UPDATE`
+	rows, err := tx.QueryContext(ctx, query, fileId, key, models.UploadSessionActive)
+	if err != nil {
+		return err
+	}
+	var sessions []*models.UploadSession
+	for rows.Next() {
+		session := &models.UploadSession{FileId: fileId}
+		if err := rows.Scan(&session.Id, &session.UploadId, &session.S3Key); err != nil {
+			rows.Close()
+			return err
+		}
+		sessions = append(sessions, session)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, session := range sessions {
+		if session.Parts, err = parts(ctx, tx, session.Id); err != nil {
+			return err
+		}
+		if err := abort(session); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE upload_sessions SET status = $1, updated_at = $2 WHERE id = $3`, models.UploadSessionAborted, now, session.Id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
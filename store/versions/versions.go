@@ -0,0 +1,284 @@
+package versions
+
+import (
+	"context"
+	"database/sql"
+	"fm/models"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/syntaxLabz/errors/pkg/codes"
+	"github.com/syntaxLabz/errors/pkg/httperrors"
+)
+
+type store struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *store {
+	return &store{db: db}
+}
+
+// versionColumns are selected from file_versions joined with files as f, so
+// is_current can be derived from the file's current_version_id. Pending
+// versions have no number yet and read as version 0.
+const versionColumns = `v.id, v.file_id, COALESCE(v.version_number, 0), v.s3_key, v.size, v.mime_type, v.checksum, v.uploaded_by, v.created_at, COALESCE(v.id = f.current_version_id, false)`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVersion(row scanner) (*models.FileVersion, error) {
+	var version models.FileVersion
+	var mimeType, checksum sql.NullString
+	err := row.Scan(
+		&version.Id,
+		&version.FileId,
+		&version.VersionNumber,
+		&version.S3Key,
+		&version.Size,
+		&mimeType,
+		&checksum,
+		&version.UploadedBy,
+		&version.CreatedAt,
+		&version.IsCurrent,
+	)
+	if err != nil {
+		return nil, err
+	}
+	version.MimeType = mimeType.String
+	version.Checksum = checksum.String
+	return &version, nil
+}
+
+// Create stores version as the next version of its file, filling in
+// VersionNumber.
+func (s *store) Create(ctx fiber.Ctx, version *models.FileVersion) (*models.FileVersion, *httperrors.Error) {
+	query := `INSERT INTO file_versions (id, file_id, version_number, s3_key, size, mime_type, checksum, uploaded_by, created_at)
+	VALUES ($1, $2, (SELECT COALESCE(MAX(version_number), 0) + 1 FROM file_versions WHERE file_id = $2), $3, $4, $5, $6, $7, $8)
+	RETURNING version_number`
+
+	if version.Id == uuid.Nil {
+		version.Id = uuid.New()
+	}
+	version.CreatedAt = time.Now().UTC()
+
+	err := s.db.QueryRowContext(ctx.Context(), query,
+		version.Id,
+		version.FileId,
+		version.S3Key,
+		version.Size,
+		version.MimeType,
+		sql.NullString{String: version.Checksum, Valid: version.Checksum != ""},
+		version.UploadedBy,
+		version.CreatedAt,
+	).Scan(&version.VersionNumber)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, httperrors.New(codes.Conflict, "Another version of the file is being recorded")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return version, nil
+}
+
+// Stage stores version as a pending version of its file, which gets its
+// number once it is committed.
+func (s *store) Stage(ctx fiber.Ctx, version *models.FileVersion) (*models.FileVersion, *httperrors.Error) {
+	query := `INSERT INTO file_versions (id, file_id, s3_key, size, mime_type, uploaded_by, created_at, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	if version.Id == uuid.Nil {
+		version.Id = uuid.New()
+	}
+	version.CreatedAt = time.Now().UTC()
+
+	_, err := s.db.ExecContext(ctx.Context(), query,
+		version.Id,
+		version.FileId,
+		version.S3Key,
+		version.Size,
+		version.MimeType,
+		version.UploadedBy,
+		version.CreatedAt,
+		models.VersionStatusPending,
+	)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return version, nil
+}
+
+// GetPending returns the pending version id.
+func (s *store) GetPending(ctx fiber.Ctx, id uuid.UUID) (*models.FileVersion, *httperrors.Error) {
+	query := `SELECT ` + versionColumns + ` FROM file_versions v JOIN files f ON f.id = v.file_id WHERE v.id = $1 AND v.status = $2`
+	version, err := scanVersion(s.db.QueryRowContext(ctx.Context(), query, id, models.VersionStatusPending))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Pending file version not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return version, nil
+}
+
+// Commit turns the pending version.Id into the next version of its file with
+// the details of the completed upload, filling in VersionNumber.
+func (s *store) Commit(ctx fiber.Ctx, version *models.FileVersion) (*models.FileVersion, *httperrors.Error) {
+	query := `UPDATE file_versions
+	SET status = $1, s3_key = $2, size = $3, mime_type = $4, checksum = $5, uploaded_by = $6, created_at = $7,
+		version_number = (SELECT COALESCE(MAX(version_number), 0) + 1 FROM file_versions WHERE file_id = $8)
+	WHERE id = $9 AND file_id = $8 AND status = $10
+	RETURNING version_number`
+
+	version.CreatedAt = time.Now().UTC()
+
+	err := s.db.QueryRowContext(ctx.Context(), query,
+		models.VersionStatusUploaded,
+		version.S3Key,
+		version.Size,
+		version.MimeType,
+		sql.NullString{String: version.Checksum, Valid: version.Checksum != ""},
+		version.UploadedBy,
+		version.CreatedAt,
+		version.FileId,
+		version.Id,
+		models.VersionStatusPending,
+	).Scan(&version.VersionNumber)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "Pending file version not found")
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, httperrors.New(codes.Conflict, "Another version of the file is being recorded")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return version, nil
+}
+
+func (s *store) GetById(ctx fiber.Ctx, id uuid.UUID) (*models.FileVersion, *httperrors.Error) {
+	query := `SELECT ` + versionColumns + ` FROM file_versions v JOIN files f ON f.id = v.file_id WHERE v.id = $1 AND v.status = $2`
+	version, err := scanVersion(s.db.QueryRowContext(ctx.Context(), query, id, models.VersionStatusUploaded))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "File version not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return version, nil
+}
+
+// GetByFileIds returns the committed versions of the given files, newest first
+// per file.
+func (s *store) GetByFileIds(ctx fiber.Ctx, fileIds []uuid.UUID) ([]models.FileVersion, *httperrors.Error) {
+	query := `SELECT ` + versionColumns + ` FROM file_versions v JOIN files f ON f.id = v.file_id WHERE v.file_id = ANY($1) AND v.status = $2 ORDER BY v.file_id, v.version_number DESC`
+	rows, err := s.db.QueryContext(ctx.Context(), query, pq.Array(fileIds), models.VersionStatusUploaded)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer rows.Close()
+
+	versions := []models.FileVersion{}
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, httperrors.New(codes.InternalServerError, err.Error())
+		}
+		versions = append(versions, *version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return versions, nil
+}
+
+// GetKeysByFileIds returns the object keys of every version of the given
+// files, pending ones included.
+func (s *store) GetKeysByFileIds(ctx context.Context, fileIds []uuid.UUID) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT s3_key FROM file_versions WHERE file_id = ANY($1)`, pq.Array(fileIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Delete removes a version that is not the current one of its file, calling
+// removeObject with the deleted row before committing.
+func (s *store) Delete(ctx fiber.Ctx, id uuid.UUID, removeObject func(version *models.FileVersion) *httperrors.Error) (*models.FileVersion, *httperrors.Error) {
+	tx, err := s.db.BeginTx(ctx.Context(), nil)
+	if err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	defer tx.Rollback()
+
+	// the file row is locked so the version can't become current meanwhile
+	query := `SELECT ` + versionColumns + ` FROM file_versions v JOIN files f ON f.id = v.file_id WHERE v.id = $1 FOR UPDATE OF f`
+	version, err := scanVersion(tx.QueryRowContext(ctx.Context(), query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, httperrors.New(codes.NotFound, "File version not found")
+		}
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	if version.IsCurrent {
+		return nil, httperrors.New(codes.Conflict, "The current version of a file cannot be deleted")
+	}
+
+	if _, err := tx.ExecContext(ctx.Context(), `DELETE FROM file_versions WHERE id = $1`, id); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+
+	if removeErr := removeObject(version); removeErr != nil {
+		return nil, removeErr
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, httperrors.New(codes.InternalServerError, err.Error())
+	}
+	return version, nil
+}
+
+// DeletePending removes the pending version id, calling removeObject with the
+// deleted row before committing. The file's pending_version_id is cleared by
+// the foreign key. It reports false when the version is gone or was committed
+// in the meantime.
+func (s *store) DeletePending(ctx context.Context, id uuid.UUID, removeObject func(version *models.FileVersion) error) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM file_versions v USING files f
+	WHERE f.id = v.file_id AND v.id = $1 AND v.status = $2
+	RETURNING ` + versionColumns
+	version, err := scanVersion(tx.QueryRowContext(ctx, query, id, models.VersionStatusPending))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if err := removeObject(version); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}